@@ -6,6 +6,7 @@ import (
 	"net/http"
 
 	"github.com/larkox/mattermost-plugin-badges/badgesmodel"
+	"github.com/larkox/mattermost-plugin-connect4/server/connect4"
 )
 
 func (p *Plugin) EnsureBadges() {
@@ -91,3 +92,21 @@ func (p *Plugin) GrantBadge(name string, userID string) {
 
 	p.API.LogDebug("Achievement granted", "badgeID", badgeID, "userID", userID, "botID", p.BotUserID)
 }
+
+// grantWinnerBadge grants the winner badge to the winner of the finished game.
+// The bot never gets it.
+func (p *Plugin) grantWinnerBadge(event GameEvent) {
+	_, _, player1, player2 := event.Game.GetMetadata()
+	winnerID := ""
+	switch winner(event.Game.Outcome()) {
+	case connect4.Player1:
+		winnerID = player1
+	case connect4.Player2:
+		winnerID = player2
+	}
+
+	if winnerID == "" || winnerID == p.BotUserID {
+		return
+	}
+	p.GrantBadge(AchievementNameWinner, winnerID)
+}
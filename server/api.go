@@ -7,6 +7,7 @@ import (
 	"math/rand"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
@@ -23,7 +24,17 @@ func (p *Plugin) initializeAPI() {
 
 	attachmentRouter := p.router.PathPrefix(AttachmentPath).Subrouter()
 	attachmentRouter.HandleFunc(AttachmentPathMove+"/{id}", p.handleMove).Methods(http.MethodPost)
+	attachmentRouter.HandleFunc(AttachmentPathColumn+"/{id}/{column:[0-9]+}", p.handleColumn).Methods(http.MethodPost)
 	attachmentRouter.HandleFunc(AttachmentPathResign+"/{id}", p.handleResign)
+	attachmentRouter.HandleFunc(AttachmentPathTakeback+"/{id}", p.handleTakeback).Methods(http.MethodPost)
+	attachmentRouter.HandleFunc(AttachmentPathTakebackAccept+"/{id}", p.handleTakebackAccept).Methods(http.MethodPost)
+	attachmentRouter.HandleFunc(AttachmentPathTakebackDecline+"/{id}", p.handleTakebackDecline).Methods(http.MethodPost)
+	attachmentRouter.HandleFunc(AttachmentPathDraw+"/{id}", p.handleDraw).Methods(http.MethodPost)
+	attachmentRouter.HandleFunc(AttachmentPathDrawAccept+"/{id}", p.handleDrawAccept).Methods(http.MethodPost)
+	attachmentRouter.HandleFunc(AttachmentPathDrawDecline+"/{id}", p.handleDrawDecline).Methods(http.MethodPost)
+	attachmentRouter.HandleFunc(AttachmentPathRematch+"/{id}", p.handleRematch).Methods(http.MethodPost)
+	attachmentRouter.HandleFunc(AttachmentPathInvitationAccept+"/{id}", p.handleInvitationAccept).Methods(http.MethodPost)
+	attachmentRouter.HandleFunc(AttachmentPathInvitationDecline+"/{id}", p.handleInvitationDecline).Methods(http.MethodPost)
 
 	p.router.HandleFunc(ImagePath+"/{id}.svg", p.handleImage).Methods(http.MethodGet)
 	p.router.HandleFunc("/test", p.handleTestGame).Methods(http.MethodGet)
@@ -52,7 +63,22 @@ func (p *Plugin) handleMove(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if !p.gameManager.CanMove(gameID, userID) {
+	playing, err := p.gameManager.IsPlayingGame(gameID, userID)
+	if err != nil {
+		p.attachmentError(w, err.Error())
+		return
+	}
+	if !playing {
+		p.attachmentError(w, "you are not playing this game")
+		return
+	}
+
+	canMove, err := p.gameManager.CanMove(gameID, userID)
+	if err != nil {
+		p.attachmentError(w, err.Error())
+		return
+	}
+	if !canMove {
 		p.attachmentError(w, "Cannot move.")
 		return
 	}
@@ -64,13 +90,19 @@ func (p *Plugin) handleMove(w http.ResponseWriter, r *http.Request) {
 			Value: strconv.Itoa(m),
 		})
 	}
+	for _, m := range p.gameManager.ValidPops(gameID) {
+		options = append(options, &model.PostActionOptions{
+			Text:  "Pop " + strconv.Itoa(m),
+			Value: PopMovementPrefix + strconv.Itoa(m),
+		})
+	}
 
 	appErr := p.API.OpenInteractiveDialog(model.OpenDialogRequest{
 		TriggerId: request.TriggerId,
 		URL:       p.getDialogURL() + DialogPathMove + "/" + gameID,
 		Dialog: model.Dialog{
 			Title: "Make your move",
-			IntroductionText: "Select the column where you want to add your next piece.\n\n" +
+			IntroductionText: "Select the column where you want to add your next piece, or the column to pop your piece from.\n\n" +
 				"![board](" + p.getImageURL(gameID) + ")",
 			SubmitLabel: "Move",
 			Elements: []model.DialogElement{
@@ -91,6 +123,42 @@ func (p *Plugin) handleMove(w http.ResponseWriter, r *http.Request) {
 	_, _ = w.Write((&model.PostActionIntegrationResponse{}).ToJson())
 }
 
+// handleColumn drops a piece in the column of the button clicked.
+func (p *Plugin) handleColumn(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	gameID := vars["id"]
+
+	userID := r.Header.Get("Mattermost-User-ID")
+	if userID == "" {
+		p.attachmentError(w, "Error: Not authorized")
+		return
+	}
+
+	column, err := strconv.Atoi(vars["column"])
+	if err != nil {
+		p.attachmentError(w, "Error: invalid column")
+		return
+	}
+
+	playing, err := p.gameManager.IsPlayingGame(gameID, userID)
+	if err != nil {
+		p.attachmentError(w, err.Error())
+		return
+	}
+	if !playing {
+		p.attachmentError(w, "you are not playing this game")
+		return
+	}
+
+	err = p.play(gameID, userID, column, false)
+	if err != nil {
+		p.attachmentError(w, err.Error())
+		return
+	}
+
+	_, _ = w.Write((&model.PostActionIntegrationResponse{}).ToJson())
+}
+
 func (p *Plugin) handleResign(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	gameID := vars["id"]
@@ -107,7 +175,12 @@ func (p *Plugin) handleResign(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if !p.gameManager.IsPlayingGame(gameID, userID) {
+	playing, err := p.gameManager.IsPlayingGame(gameID, userID)
+	if err != nil {
+		p.attachmentError(w, err.Error())
+		return
+	}
+	if !playing {
 		p.attachmentError(w, "Error: you are not playing this game")
 		return
 	}
@@ -130,6 +203,302 @@ func (p *Plugin) handleResign(w http.ResponseWriter, r *http.Request) {
 	_, _ = w.Write((&model.PostActionIntegrationResponse{}).ToJson())
 }
 
+func (p *Plugin) handleTakeback(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	gameID := vars["id"]
+
+	userID := r.Header.Get("Mattermost-User-ID")
+	if userID == "" {
+		p.attachmentError(w, "Error: Not authorized")
+		return
+	}
+
+	playing, err := p.gameManager.IsPlayingGame(gameID, userID)
+	if err != nil {
+		p.attachmentError(w, err.Error())
+		return
+	}
+	if !playing {
+		p.attachmentError(w, "you are not playing this game")
+		return
+	}
+
+	post, err := p.gameManager.RequestTakeback(gameID, userID)
+	if err != nil {
+		p.attachmentError(w, err.Error())
+		return
+	}
+
+	resp := model.PostActionIntegrationResponse{}
+	if post != nil {
+		_, _ = p.API.UpdatePost(post)
+	} else {
+		resp.EphemeralText = "Takeback requested. Waiting for your opponent to answer."
+	}
+	_, _ = w.Write(resp.ToJson())
+}
+
+func (p *Plugin) handleTakebackAccept(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	gameID := vars["id"]
+
+	userID := r.Header.Get("Mattermost-User-ID")
+	if userID == "" {
+		p.attachmentError(w, "Error: Not authorized")
+		return
+	}
+
+	playing, err := p.gameManager.IsPlayingGame(gameID, userID)
+	if err != nil {
+		p.attachmentError(w, err.Error())
+		return
+	}
+	if !playing {
+		p.attachmentError(w, "you are not playing this game")
+		return
+	}
+
+	request := model.PostActionIntegrationRequestFromJson(r.Body)
+	if request == nil {
+		p.attachmentError(w, "Error: invalid request")
+		return
+	}
+
+	post, err := p.gameManager.AcceptTakeback(gameID, userID)
+	if err != nil {
+		p.attachmentError(w, err.Error())
+		return
+	}
+
+	_, _ = p.API.UpdatePost(post)
+	p.closeEphemeralPrompt(userID, request, "You accepted the takeback request.")
+
+	_, _ = w.Write((&model.PostActionIntegrationResponse{}).ToJson())
+}
+
+func (p *Plugin) handleTakebackDecline(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	gameID := vars["id"]
+
+	userID := r.Header.Get("Mattermost-User-ID")
+	if userID == "" {
+		p.attachmentError(w, "Error: Not authorized")
+		return
+	}
+
+	playing, err := p.gameManager.IsPlayingGame(gameID, userID)
+	if err != nil {
+		p.attachmentError(w, err.Error())
+		return
+	}
+	if !playing {
+		p.attachmentError(w, "you are not playing this game")
+		return
+	}
+
+	request := model.PostActionIntegrationRequestFromJson(r.Body)
+	if request == nil {
+		p.attachmentError(w, "Error: invalid request")
+		return
+	}
+
+	err = p.gameManager.DeclineTakeback(gameID, userID)
+	if err != nil {
+		p.attachmentError(w, err.Error())
+		return
+	}
+
+	p.closeEphemeralPrompt(userID, request, "You declined the takeback request.")
+
+	_, _ = w.Write((&model.PostActionIntegrationResponse{}).ToJson())
+}
+
+func (p *Plugin) handleDraw(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	gameID := vars["id"]
+
+	userID := r.Header.Get("Mattermost-User-ID")
+	if userID == "" {
+		p.attachmentError(w, "Error: Not authorized")
+		return
+	}
+
+	playing, err := p.gameManager.IsPlayingGame(gameID, userID)
+	if err != nil {
+		p.attachmentError(w, err.Error())
+		return
+	}
+	if !playing {
+		p.attachmentError(w, "you are not playing this game")
+		return
+	}
+
+	err = p.gameManager.OfferDraw(gameID, userID)
+	if err != nil {
+		p.attachmentError(w, err.Error())
+		return
+	}
+
+	resp := model.PostActionIntegrationResponse{
+		EphemeralText: "Draw offered. Waiting for your opponent to answer.",
+	}
+	_, _ = w.Write(resp.ToJson())
+}
+
+func (p *Plugin) handleDrawAccept(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	gameID := vars["id"]
+
+	userID := r.Header.Get("Mattermost-User-ID")
+	if userID == "" {
+		p.attachmentError(w, "Error: Not authorized")
+		return
+	}
+
+	playing, err := p.gameManager.IsPlayingGame(gameID, userID)
+	if err != nil {
+		p.attachmentError(w, err.Error())
+		return
+	}
+	if !playing {
+		p.attachmentError(w, "you are not playing this game")
+		return
+	}
+
+	request := model.PostActionIntegrationRequestFromJson(r.Body)
+	if request == nil {
+		p.attachmentError(w, "Error: invalid request")
+		return
+	}
+
+	post, err := p.gameManager.AcceptDraw(gameID, userID)
+	if err != nil {
+		p.attachmentError(w, err.Error())
+		return
+	}
+
+	_, _ = p.API.UpdatePost(post)
+	p.closeEphemeralPrompt(userID, request, "You accepted the draw offer.")
+
+	_, _ = w.Write((&model.PostActionIntegrationResponse{}).ToJson())
+}
+
+func (p *Plugin) handleDrawDecline(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	gameID := vars["id"]
+
+	userID := r.Header.Get("Mattermost-User-ID")
+	if userID == "" {
+		p.attachmentError(w, "Error: Not authorized")
+		return
+	}
+
+	playing, err := p.gameManager.IsPlayingGame(gameID, userID)
+	if err != nil {
+		p.attachmentError(w, err.Error())
+		return
+	}
+	if !playing {
+		p.attachmentError(w, "you are not playing this game")
+		return
+	}
+
+	request := model.PostActionIntegrationRequestFromJson(r.Body)
+	if request == nil {
+		p.attachmentError(w, "Error: invalid request")
+		return
+	}
+
+	err = p.gameManager.DeclineDraw(gameID, userID)
+	if err != nil {
+		p.attachmentError(w, err.Error())
+		return
+	}
+
+	p.closeEphemeralPrompt(userID, request, "You declined the draw offer.")
+
+	_, _ = w.Write((&model.PostActionIntegrationResponse{}).ToJson())
+}
+
+func (p *Plugin) handleRematch(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	gameID := vars["id"]
+
+	userID := r.Header.Get("Mattermost-User-ID")
+	if userID == "" {
+		p.attachmentError(w, "Error: Not authorized")
+		return
+	}
+
+	playing, err := p.gameManager.IsPlayingGame(gameID, userID)
+	if err != nil {
+		p.attachmentError(w, err.Error())
+		return
+	}
+	if !playing {
+		p.attachmentError(w, "you are not playing this game")
+		return
+	}
+
+	post, err := p.gameManager.Rematch(gameID, userID)
+	if err != nil {
+		p.attachmentError(w, err.Error())
+		return
+	}
+
+	_, _ = p.API.UpdatePost(post)
+
+	_, _ = w.Write((&model.PostActionIntegrationResponse{}).ToJson())
+}
+
+func (p *Plugin) handleInvitationAccept(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	invitationID := vars["id"]
+
+	userID := r.Header.Get("Mattermost-User-ID")
+	if userID == "" {
+		p.attachmentError(w, "Error: Not authorized")
+		return
+	}
+
+	_, err := p.gameManager.AcceptInvitation(invitationID, userID)
+	if err != nil {
+		p.attachmentError(w, err.Error())
+		return
+	}
+
+	_, _ = w.Write((&model.PostActionIntegrationResponse{}).ToJson())
+}
+
+func (p *Plugin) handleInvitationDecline(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	invitationID := vars["id"]
+
+	userID := r.Header.Get("Mattermost-User-ID")
+	if userID == "" {
+		p.attachmentError(w, "Error: Not authorized")
+		return
+	}
+
+	err := p.gameManager.DeclineInvitation(invitationID, userID)
+	if err != nil {
+		p.attachmentError(w, err.Error())
+		return
+	}
+
+	_, _ = w.Write((&model.PostActionIntegrationResponse{}).ToJson())
+}
+
+// closeEphemeralPrompt replaces the buttons of an ephemeral post with the answer given.
+func (p *Plugin) closeEphemeralPrompt(userID string, request *model.PostActionIntegrationRequest, text string) {
+	p.API.UpdateEphemeralPost(userID, &model.Post{
+		Id:        request.PostId,
+		ChannelId: request.ChannelId,
+		UserId:    p.BotUserID,
+		Message:   text,
+	})
+}
+
 func (p *Plugin) handleMovement(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	gameID := vars["id"]
@@ -151,20 +520,55 @@ func (p *Plugin) handleMovement(w http.ResponseWriter, r *http.Request) {
 		interactiveDialogError(w, "Invalid field", map[string]string{"movement": "Could not recognize movement."})
 		return
 	}
-	movement, err := strconv.Atoi(movementStr)
+	column, isPop, err := parseMovement(movementStr)
 	if err != nil {
 		interactiveDialogError(w, "Invalid field", map[string]string{"movement": "Could not recognize movement."})
+		return
 	}
 
-	post, err := p.gameManager.Move(gameID, userID, movement)
+	err = p.play(gameID, userID, column, isPop)
 	if err != nil {
 		interactiveDialogError(w, err.Error(), nil)
 		return
 	}
 
+	_, _ = w.Write((&model.SubmitDialogResponse{}).ToJson())
+}
+
+// parseMovement returns the column of a movement, given as the column
+// number optionally prefixed with PopMovementPrefix for pops.
+func parseMovement(movement string) (int, bool, error) {
+	isPop := strings.HasPrefix(movement, PopMovementPrefix)
+	column, err := strconv.Atoi(strings.TrimPrefix(movement, PopMovementPrefix))
+	return column, isPop, err
+}
+
+// play makes the movement of the user and updates the game post.
+func (p *Plugin) play(gameID, userID string, column int, isPop bool) error {
+	var post *model.Post
+	var err error
+	if isPop {
+		post, err = p.gameManager.Pop(gameID, userID, column)
+	} else {
+		post, err = p.gameManager.Move(gameID, userID, column)
+	}
+	if err != nil {
+		return err
+	}
+
 	_, _ = p.API.UpdatePost(post)
+	return nil
+}
 
-	_, _ = w.Write((&model.SubmitDialogResponse{}).ToJson())
+// resign makes the user resign the game and updates the game post.
+func (p *Plugin) resign(gameID, userID string) error {
+	post, err := p.gameManager.Resign(gameID, userID)
+	if err != nil {
+		return err
+	}
+
+	_, _ = p.API.UpdatePost(post)
+	return nil
 }
 
 func (p *Plugin) handleResignation(w http.ResponseWriter, r *http.Request) {
@@ -177,14 +581,12 @@ func (p *Plugin) handleResignation(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	post, err := p.gameManager.Resign(gameID, userID)
+	err := p.resign(gameID, userID)
 	if err != nil {
 		interactiveDialogError(w, err.Error(), nil)
 		return
 	}
 
-	_, _ = p.API.UpdatePost(post)
-
 	_, _ = w.Write((&model.SubmitDialogResponse{}).ToJson())
 }
 
@@ -250,7 +652,7 @@ func ParseHexColor(s string) (c color.RGBA, err error) {
 
 func (p *Plugin) handleTestGame(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "image/svg+xml")
-	g := connect4.NewGame(p.BotUserID, p.BotUserID, "")
+	g := connect4.NewGame("", p.BotUserID, p.BotUserID, "", connect4.DefaultOptions())
 	rand.Seed(time.Now().UnixNano())
 	player, waiting := 2, 1
 	for i := 0; i < 1000; i++ {
@@ -3,8 +3,11 @@ package main
 import (
 	"fmt"
 	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/larkox/mattermost-plugin-connect4/server/connect4"
 	"github.com/mattermost/mattermost-server/v5/model"
 	"github.com/mattermost/mattermost-server/v5/plugin"
 )
@@ -12,8 +15,51 @@ import (
 func getHelp() string {
 	return `Available Commands:
 
-challenge @user
-	Challenge a user for a game of connect4
+challenge @user [size] [connectN] [popout] [ranked|casual]
+	Challenge a user for a game of connect4. The game starts once the user
+	accepts the challenge. It is played in the current channel if you both
+	are members, or in a direct message otherwise
+
+challenge @connect4 [size] [connectN] [easy|medium|hard]
+	Play against the connect4 bot (default medium)
+	size: board size as columns x rows, e.g. 8x7 (default 7x6)
+	connectN: how many in a row are needed to win, e.g. connect3 (default connect4)
+	popout: allow removing your own pieces from the bottom row
+	ranked: the game changes the rating of the players (default casual)
+
+challenge [size] [connectN] [popout] [ranked|casual]
+	Post an open challenge in the channel. The first member to join it
+	plays against you
+
+random [cancel]
+	Play against the next member of the team looking for a random game,
+	or stop waiting for one with cancel
+
+list
+	List your active games
+
+move <column> [game]
+	Drop a piece in the column, or pop your piece from it with pop<column>
+	(e.g. pop3) in PopOut games
+	game: the ID of the game, or its first characters, as shown by list.
+	It can be left out when you only have one active game in the channel,
+	or only one active game at all
+
+resign [game]
+	Resign the game
+
+stats [@user]
+	Show your statistics, or the ones of the user
+
+rating [@user]
+	Show your rating in ranked games and its recent changes, or the ones of the user
+
+vs @user
+	Show your head to head record against the user
+
+leaderboard [wins|rating|streak] [period]
+	Show the best players of the team by wins, rating or best win streak (default wins)
+	period: all, month for the current month, or a month like 2021-04 (default all)
 `
 }
 
@@ -23,7 +69,7 @@ func getCommand() *model.Command {
 		DisplayName:      "Connect4 Bot",
 		Description:      "Play connec4",
 		AutoComplete:     true,
-		AutoCompleteDesc: "Available commands: challenge",
+		AutoCompleteDesc: "Available commands: challenge, random, list, move, resign, stats, rating, vs, leaderboard",
 		AutoCompleteHint: "[command]",
 		AutocompleteData: getAutocompleteData(),
 	}
@@ -58,6 +104,22 @@ func (p *Plugin) ExecuteCommand(c *plugin.Context, args *model.CommandArgs) (*mo
 	switch command {
 	case "challenge":
 		handler = p.runChallengeCommand
+	case "random":
+		handler = p.runRandomCommand
+	case "list":
+		handler = p.runListCommand
+	case "stats":
+		handler = p.runStatsCommand
+	case "rating":
+		handler = p.runRatingCommand
+	case "vs":
+		handler = p.runVsCommand
+	case "leaderboard":
+		handler = p.runLeaderboardCommand
+	case "move":
+		handler = p.runMoveCommand
+	case "resign":
+		handler = p.runResignCommand
 	default:
 		p.postCommandResponse(args, getHelp())
 		return &model.CommandResponse{}, nil
@@ -80,17 +142,20 @@ func (p *Plugin) ExecuteCommand(c *plugin.Context, args *model.CommandArgs) (*mo
 }
 
 func (p *Plugin) runChallengeCommand(args []string, extra *model.CommandArgs) (bool, *model.CommandResponse, error) {
-	if len(args) < 1 {
-		p.postCommandResponse(extra, "You must specify a user to challenge.\n"+getHelp())
-		return false, nil, nil
+	if len(args) == 0 {
+		return p.runOpenChallengeCommand(args, extra)
 	}
 
-	userName := args[0]
-	if args[0][0] == '@' {
-		userName = args[0][1:]
-	}
+	// Usernames go first, so users named like an option can still be
+	// challenged without the "@"
+	userName := strings.TrimPrefix(args[0], "@")
 	receiver, appErr := p.API.GetUserByUsername(userName)
 	if appErr != nil {
+		if args[0][0] != '@' {
+			if _, err := parseGameOptions(args); err == nil {
+				return p.runOpenChallengeCommand(args, extra)
+			}
+		}
 		p.postCommandResponse(extra, "Please, provide a valid user.\n"+getHelp())
 		return false, nil, nil
 	}
@@ -100,15 +165,46 @@ func (p *Plugin) runChallengeCommand(args []string, extra *model.CommandArgs) (b
 		return false, nil, nil
 	}
 
-	err := p.gameManager.CreateGame(extra.UserId, receiver.Id)
+	options, err := parseGameOptions(args[1:])
 	if err != nil {
-		p.postCommandResponse(extra, "Could not create the game. Error: "+err.Error())
+		p.postCommandResponse(extra, err.Error()+".\n"+getHelp())
+		return false, nil, nil
+	}
+
+	if receiver.Id == p.BotUserID {
+		if options.BotLevel == connect4.BotLevelNone {
+			options.BotLevel = connect4.BotLevelMedium
+		}
+	} else if options.BotLevel != connect4.BotLevelNone {
+		p.postCommandResponse(extra, "Difficulty levels are only available when playing against the bot.\n"+getHelp())
+		return false, nil, nil
+	}
+
+	var channelID string
+	if receiver.Id == p.BotUserID {
+		// The bot always accepts
+		game, err := p.gameManager.CreateGame(extra.UserId, receiver.Id, extra.ChannelId, options)
+		if err != nil {
+			p.postCommandResponse(extra, "Could not create the game. Error: "+err.Error())
+			return false, nil, nil
+		}
+		channelID, _, _, _ = game.GetMetadata()
+	} else {
+		invitation, err := p.gameManager.Invite(extra.UserId, receiver.Id, extra.ChannelId, options, p.getConfiguration().invitationExpiry())
+		if err != nil {
+			p.postCommandResponse(extra, "Could not challenge the user. Error: "+err.Error())
+			return false, nil, nil
+		}
+		channelID = invitation.ChannelID
+	}
+
+	if channelID == extra.ChannelId {
 		return false, nil, nil
 	}
 
 	t, appErr := p.API.GetTeam(extra.TeamId)
 	if appErr != nil {
-		p.postCommandResponse(extra, "Game created, but could not redirect you to the DM. Error: "+appErr.Error())
+		p.postCommandResponse(extra, "Challenge sent, but could not redirect you to the DM. Error: "+appErr.Error())
 		return false, nil, nil
 	}
 
@@ -118,12 +214,523 @@ func (p *Plugin) runChallengeCommand(args []string, extra *model.CommandArgs) (b
 	}, nil
 }
 
+// runOpenChallengeCommand posts a challenge that any member of the channel can join.
+func (p *Plugin) runOpenChallengeCommand(args []string, extra *model.CommandArgs) (bool, *model.CommandResponse, error) {
+	options, err := parseGameOptions(args)
+	if err != nil {
+		p.postCommandResponse(extra, err.Error()+".\n"+getHelp())
+		return false, nil, nil
+	}
+
+	if options.BotLevel != connect4.BotLevelNone {
+		p.postCommandResponse(extra, "Difficulty levels are only available when playing against the bot.\n"+getHelp())
+		return false, nil, nil
+	}
+
+	_, err = p.gameManager.OpenChallenge(extra.UserId, extra.ChannelId, options, p.getConfiguration().invitationExpiry())
+	if err != nil {
+		p.postCommandResponse(extra, "Could not post the challenge. Error: "+err.Error())
+	}
+	return false, nil, nil
+}
+
+func (p *Plugin) runRandomCommand(args []string, extra *model.CommandArgs) (bool, *model.CommandResponse, error) {
+	if len(args) > 0 {
+		if len(args) > 1 || strings.ToLower(args[0]) != "cancel" {
+			p.postCommandResponse(extra, "Unrecognized option.\n"+getHelp())
+			return false, nil, nil
+		}
+
+		err := p.gameManager.LeaveQueue(extra.TeamId, extra.UserId)
+		if err != nil {
+			p.postCommandResponse(extra, "Could not leave the queue. Error: "+err.Error())
+			return false, nil, nil
+		}
+
+		p.postCommandResponse(extra, "You are no longer waiting for an opponent.")
+		return false, nil, nil
+	}
+
+	game, err := p.gameManager.JoinQueue(extra.TeamId, extra.UserId)
+	if err != nil {
+		p.postCommandResponse(extra, "Could not join the queue. Error: "+err.Error())
+		return false, nil, nil
+	}
+
+	if game == nil {
+		p.postCommandResponse(extra, "You are waiting for an opponent. You will be paired with the next member of the team looking for a game.")
+		return false, nil, nil
+	}
+
+	_, _, player1, _ := game.GetMetadata()
+	opponent, appErr := p.API.GetUser(player1)
+	if appErr != nil {
+		return false, nil, appErr
+	}
+
+	t, appErr := p.API.GetTeam(extra.TeamId)
+	if appErr != nil {
+		p.postCommandResponse(extra, "Game created, but could not redirect you to the DM. Error: "+appErr.Error())
+		return false, nil, nil
+	}
+
+	// Navigate to DM
+	return false, &model.CommandResponse{
+		GotoLocation: extra.SiteURL + "/" + t.Name + "/messages/@" + opponent.Username,
+	}, nil
+}
+
+func (p *Plugin) runListCommand(args []string, extra *model.CommandArgs) (bool, *model.CommandResponse, error) {
+	games, err := p.gameManager.ListGames(extra.UserId)
+	if err != nil {
+		p.postCommandResponse(extra, "Could not list your games. Error: "+err.Error())
+		return false, nil, nil
+	}
+
+	if len(games) == 0 {
+		p.postCommandResponse(extra, "You have no active games.")
+		return false, nil, nil
+	}
+
+	t, appErr := p.API.GetTeam(extra.TeamId)
+	if appErr != nil {
+		return false, nil, appErr
+	}
+
+	text := "| ID | Opponent | Channel | Moves | Turn | Game |\n| --- | --- | --- | --- | --- | --- |\n"
+	for _, game := range games {
+		channelID, postID, player1, player2 := game.GetMetadata()
+		opponentID := player1
+		if opponentID == extra.UserId {
+			opponentID = player2
+		}
+
+		turn := "Yours"
+		if game.GetTurnPlayer() != extra.UserId {
+			turn = "Opponent's"
+		}
+
+		text += fmt.Sprintf(
+			"| `%s` | %s | %s | %d | %s | [Open](%s) |\n",
+			game.GetID(),
+			p.getUserMention(opponentID),
+			p.getChannelMention(channelID),
+			len(game.History()),
+			turn,
+			extra.SiteURL+"/"+t.Name+"/pl/"+postID,
+		)
+	}
+
+	p.postCommandResponse(extra, text)
+	return false, nil, nil
+}
+
+func (p *Plugin) runMoveCommand(args []string, extra *model.CommandArgs) (bool, *model.CommandResponse, error) {
+	if len(args) < 1 || len(args) > 2 {
+		p.postCommandResponse(extra, "You must specify the column to play.\n"+getHelp())
+		return false, nil, nil
+	}
+
+	column, isPop, err := parseMovement(strings.ToLower(args[0]))
+	if err != nil {
+		p.postCommandResponse(extra, "Could not recognize the movement "+args[0]+".\n"+getHelp())
+		return false, nil, nil
+	}
+
+	game, err := p.gameManager.FindGame(extra.UserId, extra.ChannelId, gameArg(args[1:]))
+	if err != nil {
+		p.postCommandResponse(extra, "Could not find the game. Error: "+err.Error())
+		return false, nil, nil
+	}
+
+	err = p.play(game.GetID(), extra.UserId, column, isPop)
+	if err != nil {
+		p.postCommandResponse(extra, "Could not move. Error: "+err.Error())
+	}
+	return false, nil, nil
+}
+
+func (p *Plugin) runResignCommand(args []string, extra *model.CommandArgs) (bool, *model.CommandResponse, error) {
+	if len(args) > 1 {
+		p.postCommandResponse(extra, "Too many arguments.\n"+getHelp())
+		return false, nil, nil
+	}
+
+	game, err := p.gameManager.FindGame(extra.UserId, extra.ChannelId, gameArg(args))
+	if err != nil {
+		p.postCommandResponse(extra, "Could not find the game. Error: "+err.Error())
+		return false, nil, nil
+	}
+
+	err = p.resign(game.GetID(), extra.UserId)
+	if err != nil {
+		p.postCommandResponse(extra, "Could not resign. Error: "+err.Error())
+	}
+	return false, nil, nil
+}
+
+func (p *Plugin) runStatsCommand(args []string, extra *model.CommandArgs) (bool, *model.CommandResponse, error) {
+	user, ok := p.getUserArg(args, extra)
+	if !ok {
+		return false, nil, nil
+	}
+
+	stats, err := p.gameManager.GetStats(user.Id)
+	if err != nil {
+		p.postCommandResponse(extra, "Could not get the statistics. Error: "+err.Error())
+		return false, nil, nil
+	}
+
+	if stats.Games() == 0 {
+		p.postCommandResponse(extra, "@"+user.Username+" has not finished any game yet.")
+		return false, nil, nil
+	}
+
+	p.postCommandResponse(extra, fmt.Sprintf(
+		"#### Statistics of @%s\n"+
+			"- Games: %d (%d moving first, %d moving second)\n"+
+			"- Wins: %d\n"+
+			"- Losses: %d (%d by resignation)\n"+
+			"- Draws: %d\n"+
+			"- Win streak: %d (best %d)\n"+
+			"- Average game length: %.1f moves",
+		user.Username,
+		stats.Games(), stats.GamesAsFirst, stats.GamesAsSecond,
+		stats.Wins,
+		stats.Losses, stats.Resignations,
+		stats.Draws,
+		stats.CurrentStreak, stats.BestStreak,
+		stats.AverageLength(),
+	))
+	return false, nil, nil
+}
+
+func (p *Plugin) runRatingCommand(args []string, extra *model.CommandArgs) (bool, *model.CommandResponse, error) {
+	user, ok := p.getUserArg(args, extra)
+	if !ok {
+		return false, nil, nil
+	}
+
+	rating, err := p.gameManager.GetRating(user.Id)
+	if err != nil {
+		p.postCommandResponse(extra, "Could not get the rating. Error: "+err.Error())
+		return false, nil, nil
+	}
+
+	text := fmt.Sprintf("#### Rating of @%s: %d\n%d ranked games played", user.Username, rating.Rating, rating.Games)
+	if rating.Provisional() {
+		text += fmt.Sprintf(". The rating is provisional until %d games are played", ProvisionalGames)
+	}
+	if len(rating.History) > 0 {
+		text += "\n\n| Date | Opponent | Result | Rating |\n| --- | --- | --- | --- |\n"
+		for i := len(rating.History) - 1; i >= 0; i-- {
+			change := rating.History[i]
+			result := "Draw"
+			switch change.Score {
+			case 1:
+				result = "Win"
+			case 0:
+				result = "Loss"
+			}
+			text += fmt.Sprintf(
+				"| %s | %s | %s | %d (%+d) |\n",
+				change.Timestamp.Format("2006-01-02"),
+				p.getUserMention(change.OpponentID),
+				result,
+				change.After,
+				change.After-change.Before,
+			)
+		}
+	}
+
+	p.postCommandResponse(extra, text)
+	return false, nil, nil
+}
+
+func (p *Plugin) runVsCommand(args []string, extra *model.CommandArgs) (bool, *model.CommandResponse, error) {
+	if len(args) == 0 {
+		p.postCommandResponse(extra, "Please, provide a user.\n"+getHelp())
+		return false, nil, nil
+	}
+
+	opponent, ok := p.getUserArg(args, extra)
+	if !ok {
+		return false, nil, nil
+	}
+
+	if opponent.Id == extra.UserId {
+		p.postCommandResponse(extra, "You cannot play against yourself.")
+		return false, nil, nil
+	}
+
+	user, appErr := p.API.GetUser(extra.UserId)
+	if appErr != nil {
+		return false, nil, appErr
+	}
+
+	h, err := p.gameManager.GetHeadToHead(user.Id, opponent.Id)
+	if err != nil {
+		p.postCommandResponse(extra, "Could not get the head to head record. Error: "+err.Error())
+		return false, nil, nil
+	}
+
+	if h.Games() == 0 {
+		p.postCommandResponse(extra, "You have not finished any game against @"+opponent.Username+" yet.")
+		return false, nil, nil
+	}
+
+	wins, losses, draws := h.Record(user.Id)
+	text := fmt.Sprintf(
+		"#### %s\n"+
+			"- Games: %d\n"+
+			"- Wins: %d\n"+
+			"- Losses: %d\n"+
+			"- Draws: %d\n"+
+			"- Last results: %s (most recent last)\n",
+		headToHeadSummary(h, user, opponent),
+		h.Games(),
+		wins,
+		losses,
+		draws,
+		lastResults(h, user.Id),
+	)
+	if h.LongestStreak > 0 {
+		text += fmt.Sprintf("- Longest streak: %d wins in a row by %s", h.LongestStreak, p.getUserMention(h.LongestStreakUserID))
+	} else {
+		text += "- Longest streak: none"
+	}
+
+	p.postCommandResponse(extra, text)
+	return false, nil, nil
+}
+
+func (p *Plugin) runLeaderboardCommand(args []string, extra *model.CommandArgs) (bool, *model.CommandResponse, error) {
+	criteria := LeaderboardWins
+	period := LeaderboardAllTime
+	for _, arg := range args {
+		arg = strings.ToLower(arg)
+		switch {
+		case arg == LeaderboardWins || arg == LeaderboardRating || arg == LeaderboardStreak:
+			criteria = arg
+		case arg == "month":
+			period = monthPeriod(time.Now())
+		case ValidLeaderboardPeriod(arg):
+			period = arg
+		default:
+			p.postCommandResponse(extra, "Unrecognized option "+arg+".\n"+getHelp())
+			return false, nil, nil
+		}
+	}
+
+	leaderboard, err := p.gameManager.GetLeaderboard(extra.TeamId, period)
+	if err != nil {
+		p.postCommandResponse(extra, "Could not get the leaderboard. Error: "+err.Error())
+		return false, nil, nil
+	}
+
+	title := "all time"
+	if period != LeaderboardAllTime {
+		title = period
+	}
+
+	entries := leaderboard.Top(criteria, LeaderboardSize)
+	if len(entries) == 0 {
+		p.postCommandResponse(extra, "There are no results in the leaderboard for "+title+" yet.")
+		return false, nil, nil
+	}
+
+	text := fmt.Sprintf("#### Leaderboard by %s, %s\n| # | Player | Games | Wins | Best streak |", criteria, title)
+	if criteria == LeaderboardRating {
+		text += " Rating |"
+	}
+	text += "\n| --- | --- | --- | --- | --- |"
+	if criteria == LeaderboardRating {
+		text += " --- |"
+	}
+	text += "\n"
+	for i, e := range entries {
+		text += fmt.Sprintf("| %d | %s | %d | %d | %d |", i+1, p.getUserMention(e.UserID), e.Games, e.Wins, e.BestStreak)
+		if criteria == LeaderboardRating {
+			text += fmt.Sprintf(" %d |", e.Rating)
+		}
+		text += "\n"
+	}
+
+	p.postCommandResponse(extra, text)
+	return false, nil, nil
+}
+
+// getUserArg returns the user given as the only argument of a command, or
+// the user running the command if there are no arguments. It returns false
+// after telling the user what went wrong otherwise.
+func (p *Plugin) getUserArg(args []string, extra *model.CommandArgs) (*model.User, bool) {
+	if len(args) > 1 {
+		p.postCommandResponse(extra, "Too many arguments.\n"+getHelp())
+		return nil, false
+	}
+
+	var user *model.User
+	var appErr *model.AppError
+	if len(args) == 0 {
+		user, appErr = p.API.GetUser(extra.UserId)
+	} else {
+		user, appErr = p.API.GetUserByUsername(strings.TrimPrefix(args[0], "@"))
+	}
+	if appErr != nil {
+		p.postCommandResponse(extra, "Please, provide a valid user.\n"+getHelp())
+		return nil, false
+	}
+
+	return user, true
+}
+
+// gameArg returns the optional game argument of a command.
+func gameArg(args []string) string {
+	if len(args) == 0 {
+		return ""
+	}
+	return args[0]
+}
+
+func (p *Plugin) getUserMention(userID string) string {
+	user, appErr := p.API.GetUser(userID)
+	if appErr != nil {
+		return "Unknown user"
+	}
+
+	return "@" + user.Username
+}
+
+func (p *Plugin) getChannelMention(channelID string) string {
+	c, appErr := p.API.GetChannel(channelID)
+	if appErr != nil {
+		return "Unknown channel"
+	}
+
+	switch c.Type {
+	case model.CHANNEL_DIRECT:
+		return "Direct message"
+	case model.CHANNEL_GROUP:
+		return "Group message"
+	}
+	return "~" + c.Name
+}
+
+var botLevels = map[string]int{
+	"easy":   connect4.BotLevelEasy,
+	"medium": connect4.BotLevelMedium,
+	"hard":   connect4.BotLevelHard,
+}
+
+func parseGameOptions(args []string) (connect4.Options, error) {
+	options := connect4.DefaultOptions()
+	for _, arg := range args {
+		lowerArg := strings.ToLower(arg)
+		if lowerArg == "popout" {
+			options.PopOut = true
+			continue
+		}
+
+		if lowerArg == "ranked" || lowerArg == "casual" {
+			options.Ranked = lowerArg == "ranked"
+			continue
+		}
+
+		if level, ok := botLevels[lowerArg]; ok {
+			options.BotLevel = level
+			continue
+		}
+
+		if strings.HasPrefix(lowerArg, "connect") {
+			winLength, err := strconv.Atoi(strings.TrimPrefix(lowerArg, "connect"))
+			if err != nil {
+				return options, fmt.Errorf("unrecognized option %s", arg)
+			}
+			options.WinLength = winLength
+			continue
+		}
+
+		var columns, rows int
+		n, err := fmt.Sscanf(lowerArg, "%dx%d", &columns, &rows)
+		if err != nil || n != 2 {
+			return options, fmt.Errorf("unrecognized option %s", arg)
+		}
+		options.Columns = columns
+		options.Rows = rows
+	}
+
+	return options, options.Validate()
+}
+
 func getAutocompleteData() *model.AutocompleteData {
-	chess := model.NewAutocompleteData("connect4", "[command]", "Available commands: challenge")
+	chess := model.NewAutocompleteData("connect4", "[command]", "Available commands: challenge, random, list, move, resign, stats, rating, vs, leaderboard")
 
 	challenge := model.NewAutocompleteData("challenge", "[user]", "Challenges a user")
-	challenge.AddTextArgument("Whom to challenge", "[@someone]", "")
+	challenge.AddTextArgument("Whom to challenge, or nobody for an open challenge", "[@someone]", "")
+	challenge.AddStaticListArgument("Board size", false, []model.AutocompleteListItem{
+		{Item: "7x6", HelpText: "Classic board"},
+		{Item: "8x7"},
+		{Item: "9x7"},
+		{Item: "10x8"},
+	})
+	challenge.AddStaticListArgument("Number in a row to win", false, []model.AutocompleteListItem{
+		{Item: "connect3", HelpText: "Quick game"},
+		{Item: "connect4", HelpText: "Classic game"},
+		{Item: "connect5", HelpText: "For bigger boards"},
+	})
+	challenge.AddStaticListArgument("Variant, or difficulty when challenging @connect4", false, []model.AutocompleteListItem{
+		{Item: "popout", HelpText: "Allow removing your own pieces from the bottom row"},
+		{Item: "easy", HelpText: "Easy bot"},
+		{Item: "medium", HelpText: "Medium bot"},
+		{Item: "hard", HelpText: "Hard bot"},
+	})
+	challenge.AddStaticListArgument("Whether the game changes the rating of the players", false, []model.AutocompleteListItem{
+		{Item: "casual", HelpText: "Casual game"},
+		{Item: "ranked", HelpText: "Ranked game"},
+	})
 	chess.AddCommand(challenge)
 
+	random := model.NewAutocompleteData("random", "[cancel]", "Plays against the next member of the team looking for a game")
+	random.AddStaticListArgument("", false, []model.AutocompleteListItem{
+		{Item: "cancel", HelpText: "Stop waiting for an opponent"},
+	})
+	chess.AddCommand(random)
+
+	list := model.NewAutocompleteData("list", "", "Lists your active games")
+	chess.AddCommand(list)
+
+	move := model.NewAutocompleteData("move", "<column> [game]", "Plays a movement in one of your games")
+	move.AddTextArgument("Column to drop a piece in, or pop<column> to pop your piece", "<column>", "")
+	move.AddTextArgument("ID of the game, from list", "[game]", "")
+	chess.AddCommand(move)
+
+	resign := model.NewAutocompleteData("resign", "[game]", "Resigns one of your games")
+	resign.AddTextArgument("ID of the game, from list", "[game]", "")
+	chess.AddCommand(resign)
+
+	stats := model.NewAutocompleteData("stats", "[@user]", "Shows the statistics of a user")
+	stats.AddTextArgument("Whose statistics to show, yours by default", "[@someone]", "")
+	chess.AddCommand(stats)
+
+	rating := model.NewAutocompleteData("rating", "[@user]", "Shows the rating of a user")
+	rating.AddTextArgument("Whose rating to show, yours by default", "[@someone]", "")
+	chess.AddCommand(rating)
+
+	vs := model.NewAutocompleteData("vs", "@user", "Shows your head to head record against a user")
+	vs.AddTextArgument("Whose record against you to show", "@someone", "")
+	chess.AddCommand(vs)
+
+	leaderboard := model.NewAutocompleteData("leaderboard", "[wins|rating|streak] [period]", "Shows the best players of the team")
+	leaderboard.AddStaticListArgument("What to rank the players by", false, []model.AutocompleteListItem{
+		{Item: LeaderboardWins, HelpText: "Number of wins (default)"},
+		{Item: LeaderboardRating, HelpText: "Rating in ranked games"},
+		{Item: LeaderboardStreak, HelpText: "Best win streak"},
+	})
+	leaderboard.AddStaticListArgument("Period of the leaderboard", false, []model.AutocompleteListItem{
+		{Item: LeaderboardAllTime, HelpText: "All time (default)"},
+		{Item: "month", HelpText: "Current month"},
+	})
+	chess.AddCommand(leaderboard)
+
 	return chess
 }
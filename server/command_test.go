@@ -0,0 +1,112 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/larkox/mattermost-plugin-connect4/server/connect4"
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// runTestCommand runs the command as player1 in the channel, and returns
+// the last response sent to player1.
+func runTestCommand(t *testing.T, p *Plugin, api *testAPI, command string) string {
+	_, appErr := p.ExecuteCommand(nil, &model.CommandArgs{
+		Command:   command,
+		UserId:    "player1",
+		ChannelId: "channel",
+		TeamId:    "team",
+		SiteURL:   "http://localhost",
+	})
+	require.Nil(t, appErr)
+
+	responses := api.ephemeralPosts["player1"]
+	require.NotEmpty(t, responses)
+	return responses[len(responses)-1]
+}
+
+func TestListCommand(t *testing.T) {
+	api := newTestAPI()
+	store := NewMemoryGameStore()
+	p := &Plugin{BotUserID: "bot", gameManager: newTestGameManagerWithAPI(api, store)}
+	p.SetAPI(api)
+
+	assert.Equal(t, "You have no active games.", runTestCommand(t, p, api, "/connect4 list"))
+
+	options := connect4.DefaultOptions()
+	options.FirstPlayer = connect4.Player1
+	first := connect4.NewGame("abc1", "player1", "player2", "channel", options)
+	first.SetPostID("post1")
+	require.NoError(t, store.Save(first))
+	second := connect4.NewGame("abd2", "player3", "player1", "other", options)
+	second.SetPostID("post2")
+	require.NoError(t, store.Save(second))
+	finished := connect4.NewGame("abe3", "player1", "player2", "channel", options)
+	require.NoError(t, finished.Resign(connect4.Player1))
+	require.NoError(t, store.Save(finished))
+
+	assert.Equal(t, "| ID | Opponent | Channel | Moves | Turn | Game |\n"+
+		"| --- | --- | --- | --- | --- | --- |\n"+
+		"| `abc1` | @player2 | ~channel | 0 | Yours | [Open](http://localhost/team/pl/post1) |\n"+
+		"| `abd2` | @player3 | ~other | 0 | Opponent's | [Open](http://localhost/team/pl/post2) |\n",
+		runTestCommand(t, p, api, "/connect4 list"))
+
+	// The listed IDs, or their first characters, select the game
+	assert.Contains(t, runTestCommand(t, p, api, "/connect4 move 4 ab"), "Could not find the game")
+	runTestCommand(t, p, api, "/connect4 move 4 abc")
+	game, err := store.Get("abc1")
+	require.NoError(t, err)
+	assert.Len(t, game.History(), 1)
+
+	assert.Contains(t, runTestCommand(t, p, api, "/connect4 list"), "| `abc1` | @player2 | ~channel | 1 | Opponent's |")
+}
+
+func TestChallengeCommand(t *testing.T) {
+	api := newTestAPI()
+	store := NewMemoryGameStore()
+	p := &Plugin{BotUserID: "bot", gameManager: newTestGameManagerWithAPI(api, store)}
+	p.SetAPI(api)
+	api.users["connect4"] = &model.User{Id: "bot", Username: "connect4"}
+	api.users["easy"] = &model.User{Id: "easy", Username: "easy"}
+
+	// Sent challenges have no response
+	challenge := func(args string) {
+		_, appErr := p.ExecuteCommand(nil, &model.CommandArgs{
+			Command:   "/connect4 challenge " + args,
+			UserId:    "player1",
+			ChannelId: "channel",
+			TeamId:    "team",
+		})
+		require.Nil(t, appErr)
+		require.Empty(t, api.ephemeralPosts["player1"])
+	}
+	opponents := func() []string {
+		invitations, err := store.ListPendingInvitations()
+		require.NoError(t, err)
+		ids := []string{}
+		for _, invitation := range invitations {
+			ids = append(ids, invitation.OpponentID)
+		}
+		return ids
+	}
+
+	// Users named like an option are challenged, with or without "@"
+	challenge("easy 8x7")
+	challenge("@easy")
+	assert.ElementsMatch(t, []string{"easy", "easy"}, opponents())
+
+	challenge("connect4")
+	games, err := store.ListByUser("bot")
+	require.NoError(t, err)
+	assert.Len(t, games, 1)
+	assert.Len(t, opponents(), 2)
+
+	// Options that are nobody's username post an open challenge
+	challenge("8x7 connect5")
+	assert.ElementsMatch(t, []string{"easy", "easy", ""}, opponents())
+
+	assert.Contains(t, runTestCommand(t, p, api, "/connect4 challenge @8x7"), "Please, provide a valid user.")
+	assert.Contains(t, runTestCommand(t, p, api, "/connect4 challenge nobody"), "Please, provide a valid user.")
+	assert.Len(t, opponents(), 3)
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"reflect"
+	"time"
 
 	"github.com/pkg/errors"
 )
@@ -18,6 +19,7 @@ import (
 // If you add non-reference types to your configuration struct, be sure to rewrite Clone as a deep
 // copy appropriate for your types.
 type configuration struct {
+	InvitationExpiryMinutes int
 }
 
 // Clone shallow copies the configuration. Your implementation may require a deep copy if
@@ -27,6 +29,15 @@ func (c *configuration) Clone() *configuration {
 	return &clone
 }
 
+// invitationExpiry returns how long challenges wait to be accepted, which
+// is an hour unless configured otherwise.
+func (c *configuration) invitationExpiry() time.Duration {
+	if c.InvitationExpiryMinutes <= 0 {
+		return time.Hour
+	}
+	return time.Duration(c.InvitationExpiryMinutes) * time.Minute
+}
+
 // getConfiguration retrieves the active configuration under lock, making it safe to use
 // concurrently. The active configuration may change underneath the client of this method, but
 // the struct returned by this API call is considered immutable.
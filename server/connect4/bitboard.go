@@ -0,0 +1,111 @@
+package connect4
+
+import "math/bits"
+
+// bitboard holds one bit per square. Squares are laid out column by column,
+// from the bottom to the top, with an extra empty bit on top of each column
+// so lines cannot wrap from one column into the next one. Two 64-bit words
+// are enough for the largest supported board.
+type bitboard [2]uint64
+
+func (bb bitboard) and(o bitboard) bitboard {
+	return bitboard{bb[0] & o[0], bb[1] & o[1]}
+}
+
+func (bb bitboard) or(o bitboard) bitboard {
+	return bitboard{bb[0] | o[0], bb[1] | o[1]}
+}
+
+func (bb bitboard) xor(o bitboard) bitboard {
+	return bitboard{bb[0] ^ o[0], bb[1] ^ o[1]}
+}
+
+func (bb bitboard) andNot(o bitboard) bitboard {
+	return bitboard{bb[0] &^ o[0], bb[1] &^ o[1]}
+}
+
+func (bb bitboard) shr(n uint) bitboard {
+	if n >= 64 {
+		return bitboard{bb[1] >> (n - 64), 0}
+	}
+	return bitboard{bb[0]>>n | bb[1]<<(64-n), bb[1] >> n}
+}
+
+func (bb bitboard) shl(n uint) bitboard {
+	if n >= 64 {
+		return bitboard{0, bb[0] << (n - 64)}
+	}
+	return bitboard{bb[0] << n, bb[1]<<n | bb[0]>>(64-n)}
+}
+
+func (bb bitboard) add(o bitboard) bitboard {
+	lo, carry := bits.Add64(bb[0], o[0], 0)
+	hi, _ := bits.Add64(bb[1], o[1], carry)
+	return bitboard{lo, hi}
+}
+
+func (bb bitboard) isZero() bool {
+	return bb[0] == 0 && bb[1] == 0
+}
+
+func (bb bitboard) has(pos uint) bool {
+	return bb[pos/64]&(1<<(pos%64)) != 0
+}
+
+func (bb bitboard) set(pos uint) bitboard {
+	bb[pos/64] |= 1 << (pos % 64)
+	return bb
+}
+
+func (bb bitboard) count() int {
+	return bits.OnesCount64(bb[0]) + bits.OnesCount64(bb[1])
+}
+
+func (bb bitboard) forEach(f func(pos uint)) {
+	for w, word := range bb {
+		for word != 0 {
+			f(uint(w*64 + bits.TrailingZeros64(word)))
+			word &= word - 1
+		}
+	}
+}
+
+// runs returns the squares that start a line of n pieces going in the
+// direction of the shift. The line is built doubling its length on each
+// step, so it takes a logarithmic number of shifts.
+func runs(bb bitboard, shift uint, n int) bitboard {
+	if bb[1] == 0 {
+		return bitboard{runs64(bb[0], shift, n), 0}
+	}
+
+	r := bb
+	for length := 1; length < n; {
+		step := length
+		if n-length < step {
+			step = n - length
+		}
+		r = r.and(r.shr(uint(step) * shift))
+		length += step
+	}
+	return r
+}
+
+// runs64 is the single word version of runs, used for the boards that fit
+// in the first word and that are most of the boards played.
+func runs64(x uint64, shift uint, n int) uint64 {
+	if n == 4 {
+		r := x & (x >> shift)
+		return r & (r >> (2 * shift))
+	}
+
+	r := x
+	for length := 1; length < n; {
+		step := length
+		if n-length < step {
+			step = n - length
+		}
+		r &= r >> (uint(step) * shift)
+		length += step
+	}
+	return r
+}
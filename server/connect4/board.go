@@ -1,87 +1,233 @@
 package connect4
 
-import "errors"
-
-func newBoard() board {
-	b := board{}
-	for i := 0; i < columns; i++ {
-		column := []int{}
-		for j := 0; j < rows; j++ {
-			column = append(column, 0)
-		}
-		b = append(b, column)
+import (
+	"encoding/json"
+	"errors"
+)
+
+// board keeps one bitboard per player plus the height of each column.
+// It is stored as the [][]int representation used by the first versions of
+// the plugin, indexed by column and then by row from the top.
+type board struct {
+	columns int
+	rows    int
+	pieces  [2]bitboard
+	heights []int
+}
+
+func newBoard(columns, rows int) board {
+	return board{
+		columns: columns,
+		rows:    rows,
+		heights: make([]int, columns),
 	}
-	return b
 }
 
-func (b board) HasFinished() bool {
-	return b.checkDraw() || b.HasWon() != 0
+// position returns the bit of the square, with the row counted from the bottom starting at 0.
+func (b *board) position(columnIndex, row int) uint {
+	return uint(columnIndex*(b.rows+1) + row)
 }
 
-func (b board) HasWon() int {
-	for i, column := range b {
-		for j, square := range column {
-			if square != 0 {
-				win := b.checkWin(i, j, square)
-				if win {
-					return square
-				}
-			}
+func (b *board) cellAt(pos uint) Cell {
+	return Cell{
+		Column: int(pos)/(b.rows+1) + 1,
+		Row:    int(pos)%(b.rows+1) + 1,
+	}
+}
+
+func (b *board) columnMask(columnIndex int) bitboard {
+	return bitboard{(1 << uint(b.rows)) - 1, 0}.shl(b.position(columnIndex, 0))
+}
+
+// shifts returns the distance between two consecutive squares of a line in
+// each direction: vertical, horizontal and both diagonals.
+func (b *board) shifts() [4]uint {
+	h := uint(b.rows)
+	return [4]uint{1, h + 1, h, h + 2}
+}
+
+func (b *board) HasFinished(winLength int) bool {
+	return b.checkDraw() || b.hasLine(Player1, winLength) || b.hasLine(Player2, winLength)
+}
+
+// HasWon returns the first player with a line of at least winLength pieces,
+// along with all the lines that player has on the board.
+func (b *board) HasWon(winLength int) (int, []Line) {
+	for _, player := range []int{Player1, Player2} {
+		if b.hasLine(player, winLength) {
+			return player, b.winningLines(player, winLength)
 		}
 	}
-	return 0
+	return 0, nil
 }
 
-func (b board) checkWin(i, j, player int) bool {
-	for dx := -1; dx <= 1; dx++ {
-		for dy := -1; dy <= 1; dy++ {
-			for d := 1; d <= 3; d++ {
-				if dx == 0 && dy == 0 {
-					break
-				}
-				x := i + dx*d
-				y := j + dy*d
-				if x < 0 || x >= columns || y < 0 || y >= rows {
-					break
-				}
-				if b[x][y] != player {
-					break
-				}
-				if d == 3 {
-					return true
-				}
-			}
+func (b *board) hasLine(player, winLength int) bool {
+	pieces := b.pieces[player-1]
+	for _, shift := range b.shifts() {
+		if !runs(pieces, shift, winLength).isZero() {
+			return true
 		}
 	}
 	return false
 }
 
-func (b board) checkDraw() bool {
-	for _, column := range b {
-		if column[0] == 0 {
+// winningLines returns every maximal run of at least winLength pieces of the player.
+func (b *board) winningLines(player, winLength int) []Line {
+	pieces := b.pieces[player-1]
+	lines := []Line{}
+	for _, shift := range b.shifts() {
+		// Only count runs from their first piece
+		starts := runs(pieces, shift, winLength).andNot(pieces.shl(shift))
+		starts.forEach(func(pos uint) {
+			line := Line{}
+			for p := pos; pieces.has(p); p += shift {
+				line = append(line, b.cellAt(p))
+			}
+			lines = append(lines, line)
+		})
+	}
+	return lines
+}
+
+func (b *board) checkDraw() bool {
+	for _, h := range b.heights {
+		if h < b.rows {
 			return false
 		}
 	}
 	return true
 }
 
-func (b board) Move(column, player int) error {
+// height returns the number of pieces in the column index.
+func (b *board) height(columnIndex int) int {
+	return b.heights[columnIndex]
+}
+
+func (b *board) at(columnIndex, row int) int {
+	pos := b.position(columnIndex, row)
+	switch {
+	case b.pieces[0].has(pos):
+		return Player1
+	case b.pieces[1].has(pos):
+		return Player2
+	}
+	return 0
+}
+
+func (b *board) Move(column, player int) error {
+	columnIndex := column - 1
+	if columnIndex >= b.columns || columnIndex < 0 {
+		return errors.New("Not such column")
+	}
+
+	if b.heights[columnIndex] == b.rows {
+		return errors.New("Column full")
+	}
+
+	b.pieces[player-1] = b.pieces[player-1].set(b.position(columnIndex, b.heights[columnIndex]))
+	b.heights[columnIndex]++
+	return nil
+}
+
+func (b *board) Pop(column, player int) error {
 	columnIndex := column - 1
-	if columnIndex > columns || columnIndex < 0 {
+	if columnIndex >= b.columns || columnIndex < 0 {
 		return errors.New("Not such column")
 	}
 
-	if b[columnIndex][0] != 0 {
+	if b.at(columnIndex, 0) != player {
+		return errors.New("You can only pop your own pieces")
+	}
+
+	mask := b.columnMask(columnIndex)
+	for i, pieces := range b.pieces {
+		b.pieces[i] = pieces.andNot(mask).or(pieces.and(mask).shr(1).and(mask))
+	}
+	b.heights[columnIndex]--
+	return nil
+}
+
+// undoMove removes the top piece of the column.
+func (b *board) undoMove(column int) error {
+	columnIndex := column - 1
+	if columnIndex >= b.columns || columnIndex < 0 {
+		return errors.New("Not such column")
+	}
+
+	if b.heights[columnIndex] == 0 {
+		return errors.New("Column empty")
+	}
+
+	b.heights[columnIndex]--
+	top := bitboard{}.set(b.position(columnIndex, b.heights[columnIndex]))
+	for i, pieces := range b.pieces {
+		b.pieces[i] = pieces.andNot(top)
+	}
+	return nil
+}
+
+// undoPop puts back a piece of the player at the bottom of the column.
+func (b *board) undoPop(column, player int) error {
+	columnIndex := column - 1
+	if columnIndex >= b.columns || columnIndex < 0 {
+		return errors.New("Not such column")
+	}
+
+	if b.heights[columnIndex] == b.rows {
 		return errors.New("Column full")
 	}
 
-	toUpdate := len(b[columnIndex]) - 1
-	for i, square := range b[columnIndex] {
-		if square != 0 {
-			toUpdate = i - 1
-			break
+	mask := b.columnMask(columnIndex)
+	for i, pieces := range b.pieces {
+		b.pieces[i] = pieces.andNot(mask).or(pieces.and(mask).shl(1).and(mask))
+	}
+	b.pieces[player-1] = b.pieces[player-1].set(b.position(columnIndex, 0))
+	b.heights[columnIndex]++
+	return nil
+}
+
+// toSlice returns the board indexed by column and then by row from the top.
+func (b *board) toSlice() [][]int {
+	out := make([][]int, b.columns)
+	for i := range out {
+		out[i] = make([]int, b.rows)
+		for j := range out[i] {
+			out[i][j] = b.at(i, b.rows-1-j)
+		}
+	}
+	return out
+}
+
+func (b board) MarshalJSON() ([]byte, error) {
+	return json.Marshal(b.toSlice())
+}
+
+func (b *board) UnmarshalJSON(data []byte) error {
+	var squares [][]int
+	err := json.Unmarshal(data, &squares)
+	if err != nil {
+		return err
+	}
+
+	rows := 0
+	if len(squares) > 0 {
+		rows = len(squares[0])
+	}
+	*b = newBoard(len(squares), rows)
+	for i, column := range squares {
+		if len(column) != rows {
+			return errors.New("columns with different sizes")
+		}
+		for j, square := range column {
+			if square == 0 {
+				continue
+			}
+			if square != Player1 && square != Player2 {
+				return errors.New("unknown player in board")
+			}
+			b.pieces[square-1] = b.pieces[square-1].set(b.position(i, rows-1-j))
+			b.heights[i]++
 		}
 	}
-	b[columnIndex][toUpdate] = player
 	return nil
 }
@@ -0,0 +1,228 @@
+package connect4
+
+import (
+	"encoding/json"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sliceBoard is the previous board representation, kept to check the
+// bitboard engine against it and to measure the speedup.
+type sliceBoard [][]int
+
+func newSliceBoard(columns, rows int) sliceBoard {
+	b := sliceBoard{}
+	for i := 0; i < columns; i++ {
+		b = append(b, make([]int, rows))
+	}
+	return b
+}
+
+func (b sliceBoard) move(column, player int) {
+	for j := len(b[column]) - 1; j >= 0; j-- {
+		if b[column][j] == 0 {
+			b[column][j] = player
+			return
+		}
+	}
+}
+
+func (b sliceBoard) hasWon(winLength int) int {
+	for i, column := range b {
+		for j, square := range column {
+			if square != 0 && b.checkWin(i, j, square, winLength) {
+				return square
+			}
+		}
+	}
+	return 0
+}
+
+func (b sliceBoard) checkWin(i, j, player, winLength int) bool {
+	for dx := -1; dx <= 1; dx++ {
+		for dy := -1; dy <= 1; dy++ {
+			for d := 1; d < winLength; d++ {
+				if dx == 0 && dy == 0 {
+					break
+				}
+				x := i + dx*d
+				y := j + dy*d
+				if x < 0 || x >= len(b) || y < 0 || y >= len(b[x]) {
+					break
+				}
+				if b[x][y] != player {
+					break
+				}
+				if d == winLength-1 {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// randomMoves returns the columns of a random game, stopping on the first line.
+func randomMoves(r *rand.Rand, columns, rows, winLength int) []int {
+	b := newBoard(columns, rows)
+	moves := []int{}
+	player := Player1
+	for {
+		valid := b.GetValidMovements()
+		if len(valid) == 0 {
+			return moves
+		}
+		m := valid[r.Intn(len(valid))]
+		_ = b.Move(m, player)
+		moves = append(moves, m)
+		if b.hasLine(player, winLength) {
+			return moves
+		}
+		player = (player % 2) + 1
+	}
+}
+
+func TestBoardMatchesSliceBoard(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	sizes := [][3]int{{7, 6, 4}, {8, 7, 4}, {9, 7, 5}, {10, 8, 5}, {4, 4, 3}}
+	for _, size := range sizes {
+		for n := 0; n < 200; n++ {
+			b := newBoard(size[0], size[1])
+			sb := newSliceBoard(size[0], size[1])
+			player := Player1
+			for _, m := range randomMoves(r, size[0], size[1], size[2]) {
+				require.NoError(t, b.Move(m, player))
+				sb.move(m-1, player)
+				winner, _ := b.HasWon(size[2])
+				assert.Equal(t, sb.hasWon(size[2]), winner)
+				player = (player % 2) + 1
+			}
+			assert.Equal(t, [][]int(sb), b.toSlice())
+		}
+	}
+}
+
+func TestBoardJSON(t *testing.T) {
+	b := newBoard(7, 6)
+	for i, m := range []int{4, 4, 3, 5, 7, 7, 7} {
+		require.NoError(t, b.Move(m, i%2+1))
+	}
+
+	data, err := json.Marshal(b)
+	require.NoError(t, err)
+
+	var legacy [][]int
+	require.NoError(t, json.Unmarshal(data, &legacy))
+	assert.Equal(t, []int{0, 0, 0, 0, 0, 2}, legacy[4])
+	assert.Equal(t, []int{0, 0, 0, 1, 2, 1}, legacy[6])
+
+	var decoded board
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, b, decoded)
+}
+
+func TestBoardPop(t *testing.T) {
+	b := newBoard(7, 6)
+	for _, player := range []int{Player1, Player2, Player1} {
+		require.NoError(t, b.Move(1, player))
+	}
+	require.NoError(t, b.Move(2, Player2))
+
+	assert.Error(t, b.Pop(1, Player2))
+	require.NoError(t, b.Pop(1, Player1))
+	assert.Equal(t, []int{0, 0, 0, 0, 1, 2}, b.toSlice()[0])
+	assert.Equal(t, 2, b.height(0))
+	assert.Equal(t, []int{0, 0, 0, 0, 0, 2}, b.toSlice()[1])
+}
+
+func TestBoardWinningLines(t *testing.T) {
+	p1, p2 := Player1, Player2
+	tests := []struct {
+		name    string
+		columns [][]int
+		lines   []Line
+	}{
+		{
+			name:    "no lines",
+			columns: [][]int{{p1, p1, p1}, {p2, p2, p2}},
+			lines:   []Line{},
+		},
+		{
+			name:    "horizontal",
+			columns: [][]int{{p2}, {p1}, {p1}, {p1}, {p1}},
+			lines:   []Line{{{2, 1}, {3, 1}, {4, 1}, {5, 1}}},
+		},
+		{
+			name:    "vertical",
+			columns: [][]int{nil, nil, {p2, p1, p1, p1, p1}},
+			lines:   []Line{{{3, 2}, {3, 3}, {3, 4}, {3, 5}}},
+		},
+		{
+			name:    "diagonal up",
+			columns: [][]int{{p1}, {p2, p1}, {p2, p2, p1}, {p2, p2, p2, p1}},
+			lines:   []Line{{{1, 1}, {2, 2}, {3, 3}, {4, 4}}},
+		},
+		{
+			name:    "diagonal down",
+			columns: [][]int{{p2, p2, p2, p1}, {p2, p2, p1}, {p2, p1}, {p1}},
+			lines:   []Line{{{1, 4}, {2, 3}, {3, 2}, {4, 1}}},
+		},
+		{
+			name:    "longer than the win length",
+			columns: [][]int{{p1}, {p1}, {p1}, {p1}, {p1}, {p1}},
+			lines:   []Line{{{1, 1}, {2, 1}, {3, 1}, {4, 1}, {5, 1}, {6, 1}}},
+		},
+		{
+			name:    "several lines",
+			columns: [][]int{{p1, p1, p1, p1}, {p1}, {p1}, {p1}},
+			lines: []Line{
+				{{1, 1}, {1, 2}, {1, 3}, {1, 4}},
+				{{1, 1}, {2, 1}, {3, 1}, {4, 1}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newBoardFromColumns(t, DefaultRows, tt.columns...)
+			assert.Equal(t, tt.lines, b.winningLines(Player1, DefaultWinLength))
+		})
+	}
+}
+
+func benchmarkGames(b *testing.B) [][]int {
+	r := rand.New(rand.NewSource(1))
+	games := [][]int{}
+	for i := 0; i < 100; i++ {
+		games = append(games, randomMoves(r, DefaultColumns, DefaultRows, DefaultWinLength))
+	}
+	b.ResetTimer()
+	return games
+}
+
+func BenchmarkBoardHasWon(b *testing.B) {
+	games := benchmarkGames(b)
+	for n := 0; n < b.N; n++ {
+		moves := games[n%len(games)]
+		board := newBoard(DefaultColumns, DefaultRows)
+		for i, m := range moves {
+			_ = board.Move(m, i%2+1)
+			board.HasWon(DefaultWinLength)
+		}
+	}
+}
+
+func BenchmarkSliceBoardHasWon(b *testing.B) {
+	games := benchmarkGames(b)
+	for n := 0; n < b.N; n++ {
+		moves := games[n%len(games)]
+		board := newSliceBoard(DefaultColumns, DefaultRows)
+		for i, m := range moves {
+			board.move(m-1, i%2+1)
+			board.hasWon(DefaultWinLength)
+		}
+	}
+}
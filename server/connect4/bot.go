@@ -0,0 +1,112 @@
+package connect4
+
+import (
+	"errors"
+	"math/rand"
+)
+
+// botWinScore is above any heuristic value, so wins are always preferred.
+const botWinScore = 10000
+
+type botLevel struct {
+	// depth is the number of moves the bot looks ahead
+	depth int
+	// mistakeRate is the chance of playing a random move instead of the best one
+	mistakeRate float64
+}
+
+var botLevels = map[int]botLevel{
+	BotLevelEasy:   {depth: 2, mistakeRate: 0.3},
+	BotLevelMedium: {depth: 5, mistakeRate: 0.1},
+	BotLevelHard:   {depth: 9, mistakeRate: 0},
+}
+
+// BotMove returns the column the bot plays as the player whose turn it is,
+// using the bot level of the game. Among moves with the same value, the
+// central columns are preferred.
+func BotMove(g Game) (int, error) {
+	gm, ok := g.(*game)
+	if !ok {
+		return 0, errors.New("unknown game implementation")
+	}
+
+	level, ok := botLevels[gm.BotLevel]
+	if !ok {
+		return 0, errors.New("the game is not played against the bot")
+	}
+
+	if gm.PopOut {
+		return 0, errors.New("the bot does not play PopOut")
+	}
+
+	valid := gm.ValidMovements()
+	if len(valid) == 0 {
+		return 0, errors.New("there are no valid movements")
+	}
+
+	if rand.Float64() < level.mistakeRate {
+		return valid[rand.Intn(len(valid))], nil
+	}
+
+	geo := newGeometry(gm.Columns, gm.Rows, gm.WinLength)
+	p := gm.position(geo)
+
+	bestColumn, bestScore := -1, 0
+	for _, column := range geo.order {
+		if !p.canPlay(column) {
+			continue
+		}
+		if p.isWinningMove(column) {
+			return column + 1, nil
+		}
+
+		score := -botSearch(p.playColumn(column), level.depth-1, -botWinScore-level.depth, botWinScore+level.depth)
+		if bestColumn == -1 || score > bestScore {
+			bestColumn, bestScore = column, score
+		}
+	}
+	return bestColumn + 1, nil
+}
+
+// botSearch is a depth limited negamax with alpha-beta pruning. Positions
+// are scored by their result when the game ends within the depth, sooner
+// wins scoring more, and by the difference of winning squares of each
+// player otherwise.
+func botSearch(p position, depth, alpha, beta int) int {
+	if p.canWinNext() {
+		return botWinScore + depth
+	}
+
+	if p.moves == p.geo.size {
+		return 0
+	}
+
+	next := p.possibleNonLosingMoves()
+	if next.isZero() {
+		// Every move lets the opponent win right away
+		return -botWinScore - depth + 1
+	}
+
+	if depth <= 0 {
+		return p.winningPositions().count() - p.opponentWinningPositions().count()
+	}
+
+	var moves moveSorter
+	for i := len(p.geo.order) - 1; i >= 0; i-- {
+		move := next.and(p.geo.columnMasks[p.geo.order[i]])
+		if !move.isZero() {
+			moves.add(move, p.moveScore(move))
+		}
+	}
+
+	for move, ok := moves.next(); ok; move, ok = moves.next() {
+		score := -botSearch(p.play(move), depth-1, -beta, -alpha)
+		if score >= beta {
+			return score
+		}
+		if score > alpha {
+			alpha = score
+		}
+	}
+	return alpha
+}
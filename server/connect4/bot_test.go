@@ -0,0 +1,39 @@
+package connect4
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBotMove(t *testing.T) {
+	options := DefaultOptions()
+	options.BotLevel = BotLevelHard
+
+	t.Run("takes the win", func(t *testing.T) {
+		column, err := BotMove(newTestGame(options, 1, 2, 1, 2, 1, 2))
+		require.NoError(t, err)
+		assert.Equal(t, 1, column)
+	})
+
+	t.Run("blocks the opponent", func(t *testing.T) {
+		column, err := BotMove(newTestGame(options, 1, 2, 1, 2, 1))
+		require.NoError(t, err)
+		assert.Equal(t, 1, column)
+	})
+
+	t.Run("plays a whole game", func(t *testing.T) {
+		g := newTestGame(options)
+		for g.Outcome() == OutcomeNoOutcome {
+			column, err := BotMove(g)
+			require.NoError(t, err)
+			require.NoError(t, g.Move(column))
+		}
+	})
+
+	t.Run("not a bot game", func(t *testing.T) {
+		_, err := BotMove(newTestGame(DefaultOptions()))
+		assert.Error(t, err)
+	})
+}
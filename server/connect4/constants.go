@@ -7,7 +7,27 @@ const (
 	OutcomePlayer1Resign = -1
 	OutcomePlayer2Resign = -2
 	OutcomeDraw          = 3
+	OutcomeAgreedDraw    = 4
 
 	Player1 = 1
 	Player2 = 2
+
+	DefaultColumns = 7
+	DefaultRows    = 6
+	MinColumns     = 4
+	MaxColumns     = 10
+	MinRows        = 4
+	MaxRows        = 8
+
+	DefaultWinLength = 4
+	MinWinLength     = 3
+
+	EvaluationLoss = -1
+	EvaluationDraw = 0
+	EvaluationWin  = 1
+
+	BotLevelNone   = 0
+	BotLevelEasy   = 1
+	BotLevelMedium = 2
+	BotLevelHard   = 3
 )
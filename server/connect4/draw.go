@@ -0,0 +1,60 @@
+package connect4
+
+import "errors"
+
+// OfferDraw offers the opponent to end the game as a draw. The offer expires
+// with the next movement.
+func (g *game) OfferDraw(player int) error {
+	if g.Result != OutcomeNoOutcome {
+		return errors.New("the game has finished")
+	}
+
+	if g.DrawOfferer != 0 {
+		return errors.New("there is already a draw offer")
+	}
+
+	g.DrawOfferer = player
+	return nil
+}
+
+func (g *game) AcceptDraw(player int) error {
+	err := g.checkDrawAnswer(player)
+	if err != nil {
+		return err
+	}
+
+	g.DrawOfferer = 0
+	g.TakebackRequester = 0
+	g.Result = OutcomeAgreedDraw
+	return nil
+}
+
+func (g *game) DeclineDraw(player int) error {
+	err := g.checkDrawAnswer(player)
+	if err != nil {
+		return err
+	}
+
+	g.DrawOfferer = 0
+	return nil
+}
+
+func (g *game) checkDrawAnswer(player int) error {
+	if g.Result != OutcomeNoOutcome {
+		return errors.New("the game has finished")
+	}
+
+	if g.DrawOfferer == 0 {
+		return errors.New("there is no draw offer")
+	}
+
+	if g.DrawOfferer == player {
+		return errors.New("you cannot answer your own draw offer")
+	}
+
+	return nil
+}
+
+func (g *game) PendingDrawOffer() int {
+	return g.DrawOfferer
+}
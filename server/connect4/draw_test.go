@@ -0,0 +1,29 @@
+package connect4
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDrawOffer(t *testing.T) {
+	g := newTestGame(DefaultOptions(), 4)
+
+	require.NoError(t, g.OfferDraw(Player1))
+	assert.Error(t, g.OfferDraw(Player2))
+	assert.Error(t, g.AcceptDraw(Player1))
+	require.NoError(t, g.DeclineDraw(Player2))
+	assert.Equal(t, OutcomeNoOutcome, g.Outcome())
+
+	// The offer expires with the next movement
+	require.NoError(t, g.OfferDraw(Player1))
+	require.NoError(t, g.Move(4))
+	assert.Equal(t, 0, g.PendingDrawOffer())
+	assert.Error(t, g.AcceptDraw(Player2))
+
+	require.NoError(t, g.OfferDraw(Player2))
+	require.NoError(t, g.AcceptDraw(Player1))
+	assert.Equal(t, OutcomeAgreedDraw, g.Outcome())
+	assert.Error(t, g.OfferDraw(Player1))
+}
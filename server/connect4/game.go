@@ -8,23 +8,48 @@ import (
 	"time"
 )
 
-func NewGame(p1, p2, channelID string) Game {
+func NewGame(id, p1, p2, channelID string, options Options) Game {
 	rand.Seed(time.Now().UnixNano())
+	firstPlayer := options.FirstPlayer
+	if firstPlayer == 0 {
+		firstPlayer = rand.Intn(2) + 1
+	}
+
 	return &game{
-		Board:        newBoard(),
+		ID:           id,
+		Board:        newBoard(options.Columns, options.Rows),
+		Columns:      options.Columns,
+		Rows:         options.Rows,
+		WinLength:    options.WinLength,
+		PopOut:       options.PopOut,
+		BotLevel:     options.BotLevel,
 		Player1:      p1,
 		Player2:      p2,
 		LastMovement: 0,
 		Result:       OutcomeNoOutcome,
-		Turn:         rand.Intn(2) + 1,
+		Turn:         firstPlayer,
 		ChannelID:    channelID,
+		FirstPlayer:  firstPlayer,
+		Ranked:       options.Ranked,
 	}
 }
 
+func (g *game) GetID() string {
+	return g.ID
+}
+
 func (g *game) SetPostID(pID string) {
 	g.PostID = pID
 }
 
+func (g *game) GetDescription() string {
+	return g.Description
+}
+
+func (g *game) SetDescription(description string) {
+	g.Description = description
+}
+
 func (g *game) Outcome() int {
 	return g.Result
 }
@@ -38,28 +63,88 @@ func (g *game) GetTurnPlayer() string {
 }
 
 func (g *game) Move(movement int) error {
+	if g.Result != OutcomeNoOutcome {
+		return errors.New("the game has finished")
+	}
+
 	err := g.Board.Move(movement, g.Turn)
 	if err != nil {
 		return err
 	}
 
+	g.recordMovement(movement, g.Board.height(movement-1), false)
+	g.TakebackRequester = 0
+	g.DrawOfferer = 0
 	g.Turn = (g.Turn % 2) + 1
 	g.LastMovement = movement
+	g.LastMovementPop = false
 
-	if g.Board.HasFinished() {
-		if g.Board.checkDraw() {
+	if g.Board.HasFinished(g.WinLength) {
+		// In PopOut a full board only ends the game if the next player cannot pop
+		if g.Board.checkDraw() && len(g.ValidPops()) == 0 {
 			g.Result = OutcomeDraw
 		}
-		wonUser := g.Board.HasWon()
+		wonUser, lines := g.Board.HasWon(g.WinLength)
 		if wonUser != 0 {
 			g.Result = wonUser
+			g.Lines = lines
 		}
 	}
 
 	return nil
 }
 
+// Pop removes one of the turn player pieces from the bottom of the column.
+// If the pop completes a line for both players, the player who popped wins.
+func (g *game) Pop(column int) error {
+	if g.Result != OutcomeNoOutcome {
+		return errors.New("the game has finished")
+	}
+
+	if !g.PopOut {
+		return errors.New("popping pieces is not allowed in this game")
+	}
+
+	player := g.Turn
+	err := g.Board.Pop(column, player)
+	if err != nil {
+		return err
+	}
+
+	g.recordMovement(column, 1, true)
+	g.TakebackRequester = 0
+	g.DrawOfferer = 0
+	g.Turn = (g.Turn % 2) + 1
+	g.LastMovement = column
+	g.LastMovementPop = true
+
+	switch {
+	case g.Board.hasLine(player, g.WinLength):
+		g.Result = player
+		g.Lines = g.Board.winningLines(player, g.WinLength)
+	case g.Board.hasLine(g.Turn, g.WinLength):
+		g.Result = g.Turn
+		g.Lines = g.Board.winningLines(g.Turn, g.WinLength)
+	}
+
+	return nil
+}
+
+func (g *game) recordMovement(column, row int, pop bool) {
+	g.Movements = append(g.Movements, Movement{
+		Player:    g.Turn,
+		Column:    column,
+		Row:       row,
+		Pop:       pop,
+		Timestamp: time.Now(),
+	})
+}
+
 func (g *game) Resign(player int) error {
+	if g.Result != OutcomeNoOutcome {
+		return errors.New("the game has finished")
+	}
+
 	switch player {
 	case Player1:
 		g.Result = OutcomePlayer1Resign
@@ -69,6 +154,9 @@ func (g *game) Resign(player int) error {
 		return errors.New("player not playing this game")
 	}
 
+	g.TakebackRequester = 0
+	g.DrawOfferer = 0
+
 	return nil
 }
 
@@ -78,7 +166,7 @@ func (g *game) ToJSON() []byte {
 }
 
 func (g *game) EncodeBoard(w io.Writer) {
-	EncodeBoard(w, g.Board, g.LastMovement)
+	EncodeBoard(w, g.Board.toSlice(), g.LastMovement, g.LastMovementPop, g.Lines)
 }
 
 func GameFromJSON(b []byte) (Game, error) {
@@ -87,6 +175,22 @@ func GameFromJSON(b []byte) (Game, error) {
 	if err != nil {
 		return nil, err
 	}
+
+	// Games stored before the rules were configurable use the classic ones
+	if g.Columns == 0 {
+		g.Columns = g.Board.columns
+		g.Rows = g.Board.rows
+	}
+	if g.WinLength == 0 {
+		g.WinLength = DefaultWinLength
+	}
+	// Games stored before they had their own ID were identified by their channel
+	if g.ID == "" {
+		g.ID = g.ChannelID
+	}
+	if g.FirstPlayer == 0 {
+		g.FirstPlayer = g.firstPlayer()
+	}
 	return g, nil
 }
 
@@ -94,6 +198,73 @@ func (g *game) GetMetadata() (string, string, string, string) {
 	return g.ChannelID, g.PostID, g.Player1, g.Player2
 }
 
+func (g *game) GetOptions() Options {
+	return Options{
+		Columns:     g.Columns,
+		Rows:        g.Rows,
+		WinLength:   g.WinLength,
+		PopOut:      g.PopOut,
+		BotLevel:    g.BotLevel,
+		FirstPlayer: g.FirstPlayer,
+		Ranked:      g.Ranked,
+	}
+}
+
+// firstPlayer finds who moved first in games stored before it was recorded.
+func (g *game) firstPlayer() int {
+	if len(g.Movements) > 0 {
+		return g.Movements[0].Player
+	}
+
+	// Without pops, both players have the same number of pieces when it is
+	// the turn of the first player
+	if (g.Board.pieces[0].count()+g.Board.pieces[1].count())%2 == 0 {
+		return g.Turn
+	}
+	return g.Turn%2 + 1
+}
+
+func (g *game) RematchID() string {
+	return g.Rematch
+}
+
+// SetRematchID records the rematch of a finished game. There can only be one.
+func (g *game) SetRematchID(id string) error {
+	if g.Result == OutcomeNoOutcome {
+		return errors.New("the game has not finished")
+	}
+
+	if g.Rematch != "" {
+		return errors.New("the rematch has already started")
+	}
+
+	g.Rematch = id
+	return nil
+}
+
+// ClearRematchID forgets the rematch with the ID, when it could not start.
+func (g *game) ClearRematchID(id string) {
+	if g.Rematch == id {
+		g.Rematch = ""
+	}
+}
+
 func (g *game) ValidMovements() []int {
 	return g.Board.GetValidMovements()
 }
+
+func (g *game) ValidPops() []int {
+	if !g.PopOut {
+		return nil
+	}
+
+	return g.Board.GetValidPops(g.Turn)
+}
+
+func (g *game) WinningLines() []Line {
+	return g.Lines
+}
+
+func (g *game) History() []Movement {
+	return g.Movements
+}
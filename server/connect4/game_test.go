@@ -0,0 +1,193 @@
+package connect4
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newBoardFromColumns returns a board with the pieces of each column listed
+// from the bottom.
+func newBoardFromColumns(t *testing.T, rows int, columns ...[]int) board {
+	b := newBoard(len(columns), rows)
+	for i, column := range columns {
+		for _, player := range column {
+			require.NoError(t, b.Move(i+1, player))
+		}
+	}
+	return b
+}
+
+func TestPopOut(t *testing.T) {
+	options := DefaultOptions()
+	options.PopOut = true
+
+	t.Run("lines for both players", func(t *testing.T) {
+		// Popping the first column completes the second row for player 1
+		// and the third row for player 2
+		g := newTestGame(options)
+		g.Board = newBoardFromColumns(t, options.Rows,
+			[]int{Player1, Player2, Player1, Player2},
+			[]int{Player2, Player1, Player2},
+			[]int{Player1, Player1, Player2},
+			[]int{Player2, Player1, Player2},
+			nil, nil, nil,
+		)
+		require.Equal(t, OutcomeNoOutcome, g.Outcome())
+
+		require.NoError(t, g.Pop(1))
+		assert.Equal(t, OutcomePlayer1Win, g.Outcome())
+		assert.Equal(t, []Line{{{1, 2}, {2, 2}, {3, 2}, {4, 2}}}, g.WinningLines())
+	})
+
+	t.Run("line for the opponent", func(t *testing.T) {
+		g := newTestGame(options)
+		g.Board = newBoardFromColumns(t, options.Rows,
+			[]int{Player1, Player1, Player2},
+			[]int{Player1, Player2},
+			[]int{Player1, Player2},
+			[]int{Player2, Player2},
+			nil, nil, nil,
+		)
+
+		require.NoError(t, g.Pop(1))
+		assert.Equal(t, OutcomePlayer2Win, g.Outcome())
+		assert.Equal(t, []Line{{{1, 2}, {2, 2}, {3, 2}, {4, 2}}}, g.WinningLines())
+	})
+
+	// On a board with fewer columns than pieces needed in a row, a full
+	// board has no lines and only the pops decide if the game goes on
+	full := func(t *testing.T) *game {
+		options := Options{Columns: 4, Rows: 5, WinLength: 5, PopOut: true}
+		require.NoError(t, options.Validate())
+		g := newTestGame(options)
+		g.Board = newBoardFromColumns(t, options.Rows,
+			[]int{Player1, Player2, Player1, Player2, Player1},
+			[]int{Player1, Player2, Player1, Player2, Player1},
+			[]int{Player1, Player2, Player1, Player2, Player1},
+			[]int{Player1, Player2, Player1, Player2},
+		)
+		return g
+	}
+
+	t.Run("full board without pops", func(t *testing.T) {
+		g := full(t)
+		require.NoError(t, g.Move(4))
+		assert.Empty(t, g.ValidPops())
+		assert.Equal(t, OutcomeDraw, g.Outcome())
+	})
+
+	t.Run("full board with pops", func(t *testing.T) {
+		g := full(t)
+		g.Turn = Player2
+		require.NoError(t, g.Move(4))
+		assert.Equal(t, []int{1, 2, 3, 4}, g.ValidPops())
+		assert.Equal(t, OutcomeNoOutcome, g.Outcome())
+
+		require.NoError(t, g.Pop(2))
+		assert.Equal(t, OutcomeNoOutcome, g.Outcome())
+	})
+
+	t.Run("not allowed", func(t *testing.T) {
+		g := newTestGame(DefaultOptions(), 1)
+		assert.EqualError(t, g.Pop(1), "popping pieces is not allowed in this game")
+	})
+}
+
+func TestHistory(t *testing.T) {
+	options := DefaultOptions()
+	options.PopOut = true
+	start := time.Now()
+	g := newTestGame(options, 4, 4, 3)
+
+	rows := func() []int {
+		result := []int{}
+		for _, m := range g.History() {
+			result = append(result, m.Row)
+		}
+		return result
+	}
+
+	history := g.History()
+	require.Len(t, history, 3)
+	assert.Equal(t, Player1, history[0].Player)
+	assert.Equal(t, 4, history[0].Column)
+	assert.False(t, history[0].Pop)
+	assert.Equal(t, Player2, history[1].Player)
+	assert.Equal(t, []int{1, 2, 1}, rows())
+	for i, m := range history {
+		assert.False(t, m.Timestamp.Before(start))
+		if i > 0 {
+			assert.False(t, m.Timestamp.Before(history[i-1].Timestamp))
+		}
+	}
+
+	// The undone movement leaves the history and the row is used again
+	require.NoError(t, g.Undo())
+	assert.Equal(t, []int{1, 2}, rows())
+	require.NoError(t, g.Move(4))
+	assert.Equal(t, []int{1, 2, 3}, rows())
+
+	// Pops are recorded at the bottom row, and the pieces above them shift down
+	require.NoError(t, g.Move(5))
+	require.NoError(t, g.Pop(4))
+	last := g.History()[4]
+	assert.Equal(t, Player1, last.Player)
+	assert.Equal(t, 4, last.Column)
+	assert.Equal(t, 1, last.Row)
+	assert.True(t, last.Pop)
+	assert.False(t, last.Timestamp.Before(g.History()[3].Timestamp))
+	require.NoError(t, g.Move(4))
+	assert.Equal(t, []int{1, 2, 3, 1, 1, 3}, rows())
+
+	require.NoError(t, g.Undo())
+	require.NoError(t, g.Undo())
+	assert.Equal(t, []int{1, 2, 3, 1}, rows())
+	assert.Equal(t, 3, g.Board.height(3))
+}
+
+func TestPlayAfterFinish(t *testing.T) {
+	options := DefaultOptions()
+	options.PopOut = true
+
+	// Both players have three pieces in a column, so the next movement
+	// in any of them completes a line
+	finished := map[string]func(t *testing.T) *game{
+		"win": func(t *testing.T) *game {
+			return newTestGame(options, 1, 2, 1, 2, 1, 2, 1)
+		},
+		"resignation": func(t *testing.T) *game {
+			g := newTestGame(options, 1, 2, 1, 2, 1, 2)
+			require.NoError(t, g.Resign(Player2))
+			return g
+		},
+		"draw": func(t *testing.T) *game {
+			g := newTestGame(options, 1, 2, 1, 2, 1, 2)
+			require.NoError(t, g.OfferDraw(Player1))
+			require.NoError(t, g.AcceptDraw(Player2))
+			return g
+		},
+	}
+
+	for name, newGame := range finished {
+		t.Run(name, func(t *testing.T) {
+			g := newGame(t)
+			outcome := g.Outcome()
+			history := len(g.History())
+			require.NotEqual(t, OutcomeNoOutcome, outcome)
+
+			assert.EqualError(t, g.Move(1), "the game has finished")
+			assert.EqualError(t, g.Move(2), "the game has finished")
+			assert.EqualError(t, g.Pop(1), "the game has finished")
+			assert.EqualError(t, g.Pop(2), "the game has finished")
+			assert.EqualError(t, g.RequestTakeback(Player1), "the game has finished")
+			assert.EqualError(t, g.OfferDraw(Player2), "the game has finished")
+			assert.EqualError(t, g.Resign(Player1), "the game has finished")
+
+			assert.Equal(t, outcome, g.Outcome())
+			assert.Len(t, g.History(), history)
+		})
+	}
+}
@@ -9,13 +9,9 @@ import (
 )
 
 const (
-	rows        = 6
-	columns     = 7
-	sqrSize     = 80
-	boardWidth  = sqrSize * columns
-	boardHeight = sqrSize * (rows + 1)
-	margin      = sqrSize / 10
-	radio       = (sqrSize / 2) - margin
+	sqrSize = 80
+	margin  = sqrSize / 10
+	radio   = (sqrSize / 2) - margin
 
 	textSize = sqrSize - margin
 
@@ -24,9 +20,18 @@ const (
 	player2Color = "#fe1614"
 	emptyColor   = "#ffffff"
 	textColor    = "#000000"
+	lineColor    = "#2ecc40"
 )
 
-func EncodeBoard(w io.Writer, board [][]int, lastMovement int) {
+func EncodeBoard(w io.Writer, board [][]int, lastMovement int, lastMovementPop bool, winningLines []Line) {
+	columns := len(board)
+	rows := 0
+	if columns > 0 {
+		rows = len(board[0])
+	}
+	boardWidth := sqrSize * columns
+	boardHeight := sqrSize * (rows + 1)
+
 	canvas := svg.New(w)
 	canvas.Start(boardWidth, boardHeight, fmt.Sprintf("viewBox=\"0 0 %d %d\"", boardWidth, boardHeight))
 	canvas.Rect(0, 0, boardWidth, boardHeight, "fill:"+boardColor)
@@ -49,7 +54,11 @@ func EncodeBoard(w io.Writer, board [][]int, lastMovement int) {
 				style += emptyColor
 			}
 			canvas.Circle(x+sqrSize/2, y+sqrSize/2, radio, style)
-			if i == lastMovement-1 && !highlighted && player != 0 {
+			if i == lastMovement-1 && lastMovementPop && j == rows-1 {
+				// Mark the square the piece was popped from
+				canvas.Circle(x+sqrSize/2, y+sqrSize/2, radio/2, "fill:none;stroke:#000000;stroke-width:"+strconv.Itoa(margin))
+			}
+			if i == lastMovement-1 && !lastMovementPop && !highlighted && player != 0 {
 				canvas.Circle(x+sqrSize/2, y+sqrSize/2, radio/2, "fill: #000000")
 				highlighted = true
 			}
@@ -57,5 +66,23 @@ func EncodeBoard(w io.Writer, board [][]int, lastMovement int) {
 		textStyle := "dominant-baseline:middle;text-anchor:middle;fill:" + textColor + ";font-size:" + strconv.Itoa(textSize) + "px"
 		canvas.Text(x+sqrSize/2, (rows)*sqrSize+sqrSize/2, strconv.Itoa(i+1), textStyle)
 	}
+
+	cellCenter := func(c Cell) (int, int) {
+		return (c.Column-1)*sqrSize + sqrSize/2, (rows-c.Row)*sqrSize + sqrSize/2
+	}
+	ringStyle := "fill:none;stroke:" + lineColor + ";stroke-width:" + strconv.Itoa(margin)
+	lineStyle := "stroke:" + lineColor + ";stroke-width:" + strconv.Itoa(margin) + ";stroke-linecap:round"
+	for _, line := range winningLines {
+		if len(line) == 0 {
+			continue
+		}
+		for _, c := range line {
+			x, y := cellCenter(c)
+			canvas.Circle(x, y, radio, ringStyle)
+		}
+		x1, y1 := cellCenter(line[0])
+		x2, y2 := cellCenter(line[len(line)-1])
+		canvas.Line(x1, y1, x2, y2, lineStyle)
+	}
 	canvas.End()
 }
@@ -1,28 +1,103 @@
 package connect4
 
-import "io"
-
-type board [][]int
+import (
+	"io"
+	"time"
+)
 
 type Game interface {
+	GetID() string
 	SetPostID(pID string)
+	// GetDescription returns a text shown along the game, set when it starts.
+	GetDescription() string
+	SetDescription(description string)
 	Outcome() int
 	GetTurnPlayer() string
 	Move(movement int) error
+	Pop(column int) error
 	Resign(player int) error
 	ToJSON() []byte
 	GetMetadata() (string, string, string, string)
+	GetOptions() Options
 	EncodeBoard(w io.Writer)
 	ValidMovements() []int
+	ValidPops() []int
+	WinningLines() []Line
+	History() []Movement
+	Undo() error
+	RequestTakeback(player int) error
+	AcceptTakeback(player int) error
+	DeclineTakeback(player int) error
+	PendingTakeback() int
+	OfferDraw(player int) error
+	AcceptDraw(player int) error
+	DeclineDraw(player int) error
+	PendingDrawOffer() int
+	// RematchID returns the ID of the game started as a rematch of this
+	// one, or an empty string if there is none.
+	RematchID() string
+	SetRematchID(id string) error
+	ClearRematchID(id string)
+}
+
+// Cell identifies a square of the board. Both coordinates start at 1, the
+// column from the left and the row from the bottom.
+type Cell struct {
+	Column int
+	Row    int
+}
+
+// Line is a sequence of adjacent cells in the same direction.
+type Line []Cell
+
+// Movement records a single move of a game. For pops, Row is always the
+// bottom row the piece was removed from.
+type Movement struct {
+	Player    int
+	Column    int
+	Row       int
+	Pop       bool
+	Timestamp time.Time
+}
+
+// Options holds the rules selected when a game is created.
+type Options struct {
+	Columns   int
+	Rows      int
+	WinLength int
+	PopOut    bool
+	BotLevel  int
+	// FirstPlayer is the player who moves first. It is picked at random
+	// when it is 0.
+	FirstPlayer int
+	// Ranked games change the rating of the players
+	Ranked bool
 }
 
 type game struct {
-	Board        board
-	Player1      string
-	Player2      string
-	LastMovement int
-	Turn         int
-	ChannelID    string
-	PostID       string
-	Result       int
+	ID              string
+	Board           board
+	Columns         int
+	Rows            int
+	WinLength       int
+	PopOut          bool
+	BotLevel        int
+	Player1         string
+	Player2         string
+	LastMovement    int
+	LastMovementPop bool
+	Turn            int
+	ChannelID       string
+	PostID          string
+	Result          int
+	Lines           []Line
+	Movements       []Movement
+	// TakebackRequester is the player waiting for the opponent to accept a takeback
+	TakebackRequester int
+	// DrawOfferer is the player waiting for the opponent to accept a draw
+	DrawOfferer int
+	FirstPlayer int
+	Rematch     string
+	Ranked      bool
+	Description string
 }
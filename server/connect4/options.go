@@ -0,0 +1,50 @@
+package connect4
+
+import (
+	"errors"
+	"fmt"
+)
+
+func DefaultOptions() Options {
+	return Options{
+		Columns:   DefaultColumns,
+		Rows:      DefaultRows,
+		WinLength: DefaultWinLength,
+	}
+}
+
+func (o Options) Validate() error {
+	if o.Columns < MinColumns || o.Columns > MaxColumns {
+		return fmt.Errorf("the board must have between %d and %d columns", MinColumns, MaxColumns)
+	}
+
+	if o.Rows < MinRows || o.Rows > MaxRows {
+		return fmt.Errorf("the board must have between %d and %d rows", MinRows, MaxRows)
+	}
+
+	maxWinLength := o.Columns
+	if o.Rows > maxWinLength {
+		maxWinLength = o.Rows
+	}
+	if o.WinLength < MinWinLength || o.WinLength > maxWinLength {
+		return fmt.Errorf("the number in a row to win must be between %d and %d on this board", MinWinLength, maxWinLength)
+	}
+
+	if o.BotLevel < BotLevelNone || o.BotLevel > BotLevelHard {
+		return fmt.Errorf("unknown bot level %d", o.BotLevel)
+	}
+
+	if o.FirstPlayer != 0 && o.FirstPlayer != Player1 && o.FirstPlayer != Player2 {
+		return fmt.Errorf("unknown first player %d", o.FirstPlayer)
+	}
+
+	if o.BotLevel != BotLevelNone && o.PopOut {
+		return errors.New("the bot does not play PopOut")
+	}
+
+	if o.BotLevel != BotLevelNone && o.Ranked {
+		return errors.New("games against the bot cannot be ranked")
+	}
+
+	return nil
+}
@@ -0,0 +1,191 @@
+package connect4
+
+import "math/bits"
+
+// geometry holds the masks shared by every search position of a board size.
+type geometry struct {
+	columns   int
+	rows      int
+	winLength int
+	size      int
+	shifts    [4]uint
+	bottom    bitboard
+	full      bitboard
+	// narrow is set when the whole board fits in the first word
+	narrow bool
+	// columnMasks, bottomMasks and topMasks are indexed by column
+	columnMasks []bitboard
+	bottomMasks []bitboard
+	topMasks    []bitboard
+	// order lists the columns from the center to the sides, which are
+	// usually the best moves.
+	order []int
+}
+
+func newGeometry(columns, rows, winLength int) *geometry {
+	b := newBoard(columns, rows)
+	g := &geometry{
+		columns:   columns,
+		rows:      rows,
+		winLength: winLength,
+		size:      columns * rows,
+		shifts:    b.shifts(),
+	}
+	for i := 0; i < columns; i++ {
+		g.columnMasks = append(g.columnMasks, b.columnMask(i))
+		g.bottomMasks = append(g.bottomMasks, bitboard{}.set(b.position(i, 0)))
+		g.topMasks = append(g.topMasks, bitboard{}.set(b.position(i, rows-1)))
+		g.bottom = g.bottom.or(g.bottomMasks[i])
+		g.full = g.full.or(g.columnMasks[i])
+		g.order = append(g.order, columns/2+(1-2*(i%2))*(i+1)/2)
+	}
+	g.narrow = columns*(rows+1) <= 64
+	return g
+}
+
+func (g *geometry) equal(other *geometry) bool {
+	return g.columns == other.columns && g.rows == other.rows && g.winLength == other.winLength
+}
+
+// winningPositions returns the empty squares that would complete a line for the pieces.
+func (g *geometry) winningPositions(pieces, mask bitboard) bitboard {
+	if g.narrow {
+		return bitboard{g.winningPositions64(pieces[0]) & (g.full[0] &^ mask[0]), 0}
+	}
+
+	var after, before [MaxColumns + 1]bitboard
+	all := bitboard{^uint64(0), ^uint64(0)}
+	r := bitboard{}
+	for _, shift := range g.shifts {
+		// after[k] and before[k] have the squares with k pieces in a row
+		// next to them in each way of the direction
+		after[0], before[0] = all, all
+		for k := 1; k < g.winLength; k++ {
+			after[k] = after[k-1].and(pieces.shr(uint(k) * shift))
+			before[k] = before[k-1].and(pieces.shl(uint(k) * shift))
+		}
+		for k := 0; k < g.winLength; k++ {
+			r = r.or(after[k].and(before[g.winLength-1-k]))
+		}
+	}
+	return r.and(g.full.andNot(mask))
+}
+
+// winningPositions64 is the single word version of winningPositions, without the final mask.
+func (g *geometry) winningPositions64(pieces uint64) uint64 {
+	if g.winLength == 4 {
+		// Vertical
+		r := (pieces << 1) & (pieces << 2) & (pieces << 3)
+		for _, shift := range g.shifts[1:] {
+			p := (pieces << shift) & (pieces << (2 * shift))
+			r |= p & (pieces << (3 * shift))
+			r |= p & (pieces >> shift)
+			p = (pieces >> shift) & (pieces >> (2 * shift))
+			r |= p & (pieces << shift)
+			r |= p & (pieces >> (3 * shift))
+		}
+		return r
+	}
+
+	var after, before [MaxColumns + 1]uint64
+	r := uint64(0)
+	for _, shift := range g.shifts {
+		after[0], before[0] = ^uint64(0), ^uint64(0)
+		for k := 1; k < g.winLength; k++ {
+			after[k] = after[k-1] & (pieces >> (uint(k) * shift))
+			before[k] = before[k-1] & (pieces << (uint(k) * shift))
+		}
+		for k := 0; k < g.winLength; k++ {
+			r |= after[k] & before[g.winLength-1-k]
+		}
+	}
+	return r
+}
+
+// position is a compact board used while searching, seen from the player to move.
+type position struct {
+	geo *geometry
+	// current has the pieces of the player to move and mask the pieces of both players
+	current bitboard
+	mask    bitboard
+	moves   int
+}
+
+// position returns the search position of the game for the player whose turn it is.
+func (g *game) position(geo *geometry) position {
+	mask := g.Board.pieces[0].or(g.Board.pieces[1])
+	return position{
+		geo:     geo,
+		current: g.Board.pieces[g.Turn-1],
+		mask:    mask,
+		moves:   mask.count(),
+	}
+}
+
+func (p position) canPlay(column int) bool {
+	return p.mask.and(p.geo.topMasks[column]).isZero()
+}
+
+func (p position) play(move bitboard) position {
+	p.current = p.current.xor(p.mask)
+	p.mask = p.mask.or(move)
+	p.moves++
+	return p
+}
+
+func (p position) playColumn(column int) position {
+	return p.play(p.mask.add(p.geo.bottomMasks[column]).and(p.geo.columnMasks[column]))
+}
+
+func (p position) isWinningMove(column int) bool {
+	return !p.winningPositions().and(p.possible()).and(p.geo.columnMasks[column]).isZero()
+}
+
+// key identifies the position. It is exact when it fits in one word, which
+// is the case of the classic board, and a hash otherwise.
+func (p position) key() uint64 {
+	k := p.current.add(p.mask).add(p.geo.bottom)
+	if k[1] == 0 {
+		return k[0]
+	}
+	return k[0] ^ bits.RotateLeft64(k[1]*0x9e3779b97f4a7c15, 32)
+}
+
+func (p position) possible() bitboard {
+	return p.mask.add(p.geo.bottom).and(p.geo.full)
+}
+
+func (p position) winningPositions() bitboard {
+	return p.geo.winningPositions(p.current, p.mask)
+}
+
+func (p position) opponentWinningPositions() bitboard {
+	return p.geo.winningPositions(p.current.xor(p.mask), p.mask)
+}
+
+func (p position) canWinNext() bool {
+	return !p.winningPositions().and(p.possible()).isZero()
+}
+
+// possibleNonLosingMoves returns the moves that do not let the opponent win
+// right away. It must only be called when the player to move cannot win
+// with the next move.
+func (p position) possibleNonLosingMoves() bitboard {
+	possible := p.possible()
+	opponentWin := p.opponentWinningPositions()
+	forced := possible.and(opponentWin)
+	if !forced.isZero() {
+		if forced.count() > 1 {
+			// The opponent has two winning moves and only one can be blocked
+			return bitboard{}
+		}
+		possible = forced
+	}
+	// Do not play below an opponent winning square
+	return possible.andNot(opponentWin.shr(1))
+}
+
+// moveScore counts the winning squares the player to move gets by playing the move.
+func (p position) moveScore(move bitboard) int {
+	return p.geo.winningPositions(p.current.or(move), p.mask.or(move)).count()
+}
@@ -0,0 +1,364 @@
+package connect4
+
+import (
+	"errors"
+	"sync"
+)
+
+const (
+	// solverTableSize is a prime close to 2^23. Together with the 32 bits
+	// kept from each key, it identifies exactly every position of boards
+	// with up to 55 cells counting an extra row, like the classic board.
+	solverTableSize = 8388593
+	// maxSolverTables bounds the memory used by solvers, around 40MB per
+	// table. Solvers wait for a table when all of them are in use.
+	maxSolverTables = 2
+)
+
+// Evaluation is the game-theoretic value of a position for the player to
+// move, assuming perfect play from both players.
+type Evaluation struct {
+	// Result is one of EvaluationWin, EvaluationDraw or EvaluationLoss.
+	Result int
+	// Moves is the number of moves, counting both players, until the game
+	// ends. The last one is the winning move, or the one filling the board
+	// on draws.
+	Moves int
+	// Score is positive when winning and negative when losing. The sooner
+	// the game is won, the bigger its absolute value.
+	Score int
+}
+
+type transpositionTable struct {
+	keys   []uint32
+	values []int8
+	// geo is the geometry of the positions stored in the table
+	geo *geometry
+}
+
+func newTranspositionTable(size int) *transpositionTable {
+	return &transpositionTable{
+		keys:   make([]uint32, size),
+		values: make([]int8, size),
+	}
+}
+
+func (t *transpositionTable) put(key uint64, value int8) {
+	i := key % uint64(len(t.keys))
+	t.keys[i] = uint32(key)
+	t.values[i] = value
+}
+
+// get returns 0 when the key is not in the table.
+func (t *transpositionTable) get(key uint64) int8 {
+	i := key % uint64(len(t.keys))
+	if t.keys[i] != uint32(key) {
+		return 0
+	}
+	return t.values[i]
+}
+
+func (t *transpositionTable) reset() {
+	for i := range t.keys {
+		t.keys[i] = 0
+		t.values[i] = 0
+	}
+}
+
+// tablePool shares the transposition tables among solvers, creating them
+// as needed up to maxSolverTables.
+type tablePool struct {
+	lock    sync.Mutex
+	created int
+	tables  chan *transpositionTable
+}
+
+var solverTables = &tablePool{tables: make(chan *transpositionTable, maxSolverTables)}
+
+// acquire returns a table with the positions of the geometry, or an empty one.
+func (p *tablePool) acquire(geo *geometry) *transpositionTable {
+	var t *transpositionTable
+	select {
+	case t = <-p.tables:
+	default:
+		p.lock.Lock()
+		if p.created < maxSolverTables {
+			p.created++
+			p.lock.Unlock()
+			t = newTranspositionTable(solverTableSize)
+		} else {
+			p.lock.Unlock()
+			t = <-p.tables
+		}
+	}
+
+	// The same key means different positions on different boards
+	if t.geo != nil && !t.geo.equal(geo) {
+		t.reset()
+	}
+	t.geo = geo
+	return t
+}
+
+func (p *tablePool) release(t *transpositionTable) {
+	p.tables <- t
+}
+
+type moveSorter struct {
+	size    int
+	entries [MaxColumns]struct {
+		move  bitboard
+		score int
+	}
+}
+
+// add keeps the entries sorted by score. Among equal scores, the last
+// added move is returned first.
+func (s *moveSorter) add(move bitboard, score int) {
+	pos := s.size
+	s.size++
+	for ; pos > 0 && s.entries[pos-1].score > score; pos-- {
+		s.entries[pos] = s.entries[pos-1]
+	}
+	s.entries[pos].move = move
+	s.entries[pos].score = score
+}
+
+func (s *moveSorter) next() (bitboard, bool) {
+	if s.size == 0 {
+		return bitboard{}, false
+	}
+	s.size--
+	return s.entries[s.size].move, true
+}
+
+// Solver finds the game-theoretic value of positions with a negamax search
+// using alpha-beta pruning, move ordering and a transposition table. It
+// supports every board size and win length, but not PopOut games. Values
+// are exact on boards with up to 55 cells counting an extra row, like the
+// classic 7x6 board. On bigger boards positions are hashed, and a rare
+// collision may give a wrong value. Solvers share a bounded set of tables,
+// so a Solver only holds one while solving. A Solver is not safe for
+// concurrent use.
+type Solver struct {
+	// table is only set while solving
+	table *transpositionTable
+	geo   *geometry
+	// minScore is below any score, so stored values are always positive
+	minScore int
+	nodes    uint64
+}
+
+func NewSolver() *Solver {
+	return &Solver{}
+}
+
+// Solve returns the value of the game for the player whose turn it is.
+func (s *Solver) Solve(g Game) (Evaluation, error) {
+	p, err := s.position(g)
+	if err != nil {
+		return Evaluation{}, err
+	}
+
+	s.acquireTable()
+	defer s.releaseTable()
+	return s.evaluation(p, s.solve(p)), nil
+}
+
+// BestMove returns the column with the best value for the player whose
+// turn it is, along with the value of the game. The central columns are
+// preferred among moves with the same value.
+func (s *Solver) BestMove(g Game) (int, Evaluation, error) {
+	p, err := s.position(g)
+	if err != nil {
+		return 0, Evaluation{}, err
+	}
+
+	playable := []int{}
+	for _, column := range s.geo.order {
+		if p.canPlay(column) {
+			playable = append(playable, column)
+		}
+	}
+	if len(playable) == 0 {
+		return 0, Evaluation{}, errors.New("there are no valid movements")
+	}
+
+	s.acquireTable()
+	defer s.releaseTable()
+
+	score := s.solve(p)
+	for _, column := range playable {
+		if p.isWinningMove(column) {
+			return column + 1, s.evaluation(p, score), nil
+		}
+	}
+
+	// Look for the first move that keeps the score, checking each one with a null window search
+	for _, column := range playable {
+		child := p.playColumn(column)
+		if child.canWinNext() {
+			continue
+		}
+		if -s.negamax(child, -score, -score+1) >= score {
+			return column + 1, s.evaluation(p, score), nil
+		}
+	}
+
+	// Every move loses right away
+	return playable[0] + 1, s.evaluation(p, score), nil
+}
+
+// Nodes returns the number of positions explored since the solver was created.
+func (s *Solver) Nodes() uint64 {
+	return s.nodes
+}
+
+func (s *Solver) position(g Game) (position, error) {
+	gm, ok := g.(*game)
+	if !ok {
+		return position{}, errors.New("unknown game implementation")
+	}
+
+	if gm.PopOut {
+		return position{}, errors.New("PopOut games cannot be solved")
+	}
+
+	if gm.Result != OutcomeNoOutcome {
+		return position{}, errors.New("the game has finished")
+	}
+
+	s.setGeometry(gm.Columns, gm.Rows, gm.WinLength)
+	return gm.position(s.geo), nil
+}
+
+func (s *Solver) setGeometry(columns, rows, winLength int) {
+	if s.geo != nil && s.geo.columns == columns && s.geo.rows == rows && s.geo.winLength == winLength {
+		return
+	}
+
+	s.geo = newGeometry(columns, rows, winLength)
+	s.minScore = -s.geo.size/2 - 1
+}
+
+func (s *Solver) acquireTable() {
+	s.table = solverTables.acquire(s.geo)
+}
+
+func (s *Solver) releaseTable() {
+	solverTables.release(s.table)
+	s.table = nil
+}
+
+func (s *Solver) evaluation(p position, score int) Evaluation {
+	e := Evaluation{Score: score}
+	// The score only depends on the number of pieces on the board when the
+	// winning move is played, counting the winning move out. Two numbers of
+	// pieces map to each score, and only one has the parity of the winner.
+	switch {
+	case score > 0:
+		n := s.geo.size + 1 - 2*score
+		if (n-p.moves)%2 != 0 {
+			n--
+		}
+		e.Result = EvaluationWin
+		e.Moves = n - p.moves + 1
+	case score < 0:
+		n := s.geo.size + 1 + 2*score
+		if (n-p.moves)%2 == 0 {
+			n--
+		}
+		e.Result = EvaluationLoss
+		e.Moves = n - p.moves + 1
+	default:
+		e.Result = EvaluationDraw
+		e.Moves = s.geo.size - p.moves
+	}
+	return e
+}
+
+// solve narrows the score of the position with null window searches.
+func (s *Solver) solve(p position) int {
+	if p.canWinNext() {
+		return (s.geo.size + 1 - p.moves) / 2
+	}
+
+	min := -(s.geo.size - p.moves) / 2
+	max := (s.geo.size + 1 - p.moves) / 2
+	for min < max {
+		med := min + (max-min)/2
+		if med <= 0 && min/2 < med {
+			med = min / 2
+		} else if med >= 0 && max/2 > med {
+			med = max / 2
+		}
+
+		r := s.negamax(p, med, med+1)
+		if r <= med {
+			max = r
+		} else {
+			min = r
+		}
+	}
+	return min
+}
+
+// negamax returns the exact score of the position if it is between alpha
+// and beta, an upper bound lower than alpha or a lower bound greater than
+// beta otherwise. The player to move must not be able to win with the
+// next move.
+func (s *Solver) negamax(p position, alpha, beta int) int {
+	s.nodes++
+
+	next := p.possibleNonLosingMoves()
+	if next.isZero() {
+		return -(s.geo.size - p.moves) / 2
+	}
+
+	if p.moves >= s.geo.size-2 {
+		return 0
+	}
+
+	// The opponent cannot win with the next move
+	min := -(s.geo.size - 2 - p.moves) / 2
+	if alpha < min {
+		alpha = min
+		if alpha >= beta {
+			return alpha
+		}
+	}
+
+	// We cannot win with the next move
+	max := (s.geo.size - 1 - p.moves) / 2
+	key := p.key()
+	if v := s.table.get(key); v != 0 {
+		max = int(v) + s.minScore - 1
+	}
+	if beta > max {
+		beta = max
+		if alpha >= beta {
+			return beta
+		}
+	}
+
+	var moves moveSorter
+	for i := len(s.geo.order) - 1; i >= 0; i-- {
+		move := next.and(s.geo.columnMasks[s.geo.order[i]])
+		if !move.isZero() {
+			moves.add(move, p.moveScore(move))
+		}
+	}
+
+	for move, ok := moves.next(); ok; move, ok = moves.next() {
+		score := -s.negamax(p.play(move), -beta, -alpha)
+		if score >= beta {
+			return score
+		}
+		if score > alpha {
+			alpha = score
+		}
+	}
+
+	s.table.put(key, int8(alpha-s.minScore+1))
+	return alpha
+}
@@ -0,0 +1,160 @@
+package connect4
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type bruteForceKey struct {
+	pieces [2]bitboard
+	player int
+}
+
+// bruteForceScore explores the whole game tree to score the position with
+// the same scale used by the solver.
+func bruteForceScore(b board, player, winLength int, memo map[bruteForceKey]int) int {
+	key := bruteForceKey{b.pieces, player}
+	if score, ok := memo[key]; ok {
+		return score
+	}
+
+	size := b.columns * b.rows
+	moves := b.pieces[0].or(b.pieces[1]).count()
+	valid := b.GetValidMovements()
+	for _, m := range valid {
+		child := cloneBoard(b)
+		_ = child.Move(m, player)
+		if child.hasLine(player, winLength) {
+			memo[key] = (size + 1 - moves) / 2
+			return memo[key]
+		}
+	}
+
+	best := 0
+	for i, m := range valid {
+		child := cloneBoard(b)
+		_ = child.Move(m, player)
+		score := -bruteForceScore(child, player%2+1, winLength, memo)
+		if i == 0 || score > best {
+			best = score
+		}
+	}
+	memo[key] = best
+	return best
+}
+
+func cloneBoard(b board) board {
+	b.heights = append([]int{}, b.heights...)
+	return b
+}
+
+func newTestGame(options Options, moves ...int) *game {
+	g := NewGame("id", "a", "b", "c", options).(*game)
+	g.Turn = Player1
+	for _, m := range moves {
+		_ = g.Move(m)
+	}
+	return g
+}
+
+func TestSolverMatchesBruteForce(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	solver := NewSolver()
+	rules := []Options{
+		{Columns: 4, Rows: 4, WinLength: 3},
+		{Columns: 5, Rows: 4, WinLength: 4},
+		{Columns: 4, Rows: 5, WinLength: 4},
+	}
+	for _, options := range rules {
+		memo := map[bruteForceKey]int{}
+		for n := 0; n < 50; n++ {
+			g := newTestGame(options)
+			for i := r.Intn(10) + 4; i > 0 && g.Outcome() == OutcomeNoOutcome; i-- {
+				valid := g.ValidMovements()
+				_ = g.Move(valid[r.Intn(len(valid))])
+			}
+			if g.Outcome() != OutcomeNoOutcome {
+				continue
+			}
+
+			e, err := solver.Solve(g)
+			require.NoError(t, err)
+			assert.Equal(t, bruteForceScore(cloneBoard(g.Board), g.Turn, options.WinLength, memo), e.Score)
+		}
+	}
+}
+
+func TestSolverEvaluation(t *testing.T) {
+	solver := NewSolver()
+
+	t.Run("win in one", func(t *testing.T) {
+		g := newTestGame(DefaultOptions(), 1, 2, 1, 2, 1, 2)
+		e, err := solver.Solve(g)
+		require.NoError(t, err)
+		assert.Equal(t, Evaluation{Result: EvaluationWin, Moves: 1, Score: 18}, e)
+
+		column, _, err := solver.BestMove(g)
+		require.NoError(t, err)
+		assert.Equal(t, 1, column)
+	})
+
+	t.Run("loss in two", func(t *testing.T) {
+		// The player to move cannot stop both ends of the open three
+		g := newTestGame(DefaultOptions(), 3, 3, 4, 4, 5)
+		e, err := solver.Solve(g)
+		require.NoError(t, err)
+		assert.Equal(t, EvaluationLoss, e.Result)
+		assert.Equal(t, 2, e.Moves)
+	})
+
+	t.Run("PopOut", func(t *testing.T) {
+		options := DefaultOptions()
+		options.PopOut = true
+		_, err := solver.Solve(newTestGame(options))
+		assert.Error(t, err)
+	})
+
+	t.Run("finished game", func(t *testing.T) {
+		_, err := solver.Solve(newTestGame(DefaultOptions(), 1, 2, 1, 2, 1, 2, 1))
+		assert.Error(t, err)
+	})
+}
+
+func TestSolverClassicBoard(t *testing.T) {
+	if testing.Short() {
+		t.Skip("solving the classic board takes a while")
+	}
+
+	solver := NewSolver()
+	g := newTestGame(DefaultOptions(), 4, 3, 4, 4, 3, 5, 2)
+	e, err := solver.Solve(g)
+	require.NoError(t, err)
+	assert.Equal(t, Evaluation{Result: EvaluationWin, Moves: 29, Score: 4}, e)
+
+	// The best move keeps the value of the game
+	column, bestEvaluation, err := solver.BestMove(g)
+	require.NoError(t, err)
+	assert.Equal(t, e, bestEvaluation)
+	require.NoError(t, g.Move(column))
+
+	next, err := solver.Solve(g)
+	require.NoError(t, err)
+	assert.Equal(t, -e.Score, next.Score)
+	assert.Equal(t, e.Moves-1, next.Moves)
+}
+
+func TestSolverTables(t *testing.T) {
+	// Many solvers on different boards share a bounded number of tables
+	for _, columns := range []int{4, 5, 4} {
+		options := DefaultOptions()
+		options.Columns = columns
+		options.Rows = 4
+		_, err := NewSolver().Solve(newTestGame(options, 1, 2))
+		require.NoError(t, err)
+	}
+	assert.LessOrEqual(t, solverTables.created, maxSolverTables)
+	assert.Len(t, solverTables.tables, solverTables.created)
+}
@@ -0,0 +1,95 @@
+package connect4
+
+import "errors"
+
+// Undo reverts the last movement, including the turn and the result it led to.
+func (g *game) Undo() error {
+	if len(g.Movements) == 0 {
+		return errors.New("there are no movements to take back")
+	}
+
+	last := g.Movements[len(g.Movements)-1]
+	var err error
+	if last.Pop {
+		err = g.Board.undoPop(last.Column, last.Player)
+	} else {
+		err = g.Board.undoMove(last.Column)
+	}
+	if err != nil {
+		return err
+	}
+
+	g.Movements = g.Movements[:len(g.Movements)-1]
+	g.Turn = last.Player
+	g.Result = OutcomeNoOutcome
+	g.Lines = nil
+	g.TakebackRequester = 0
+	g.DrawOfferer = 0
+	g.LastMovement = 0
+	g.LastMovementPop = false
+	if len(g.Movements) > 0 {
+		previous := g.Movements[len(g.Movements)-1]
+		g.LastMovement = previous.Column
+		g.LastMovementPop = previous.Pop
+	}
+
+	return nil
+}
+
+// RequestTakeback asks the opponent to revert the last movement. Only the
+// player who made it can ask for it.
+func (g *game) RequestTakeback(player int) error {
+	if g.Result != OutcomeNoOutcome {
+		return errors.New("the game has finished")
+	}
+
+	if len(g.Movements) == 0 || g.Movements[len(g.Movements)-1].Player != player {
+		return errors.New("you can only take back your last movement")
+	}
+
+	if g.TakebackRequester != 0 {
+		return errors.New("there is already a takeback request")
+	}
+
+	g.TakebackRequester = player
+	return nil
+}
+
+func (g *game) AcceptTakeback(player int) error {
+	err := g.checkTakebackAnswer(player)
+	if err != nil {
+		return err
+	}
+
+	return g.Undo()
+}
+
+func (g *game) DeclineTakeback(player int) error {
+	err := g.checkTakebackAnswer(player)
+	if err != nil {
+		return err
+	}
+
+	g.TakebackRequester = 0
+	return nil
+}
+
+func (g *game) checkTakebackAnswer(player int) error {
+	if g.Result != OutcomeNoOutcome {
+		return errors.New("the game has finished")
+	}
+
+	if g.TakebackRequester == 0 {
+		return errors.New("there is no takeback request")
+	}
+
+	if g.TakebackRequester == player {
+		return errors.New("you cannot answer your own takeback request")
+	}
+
+	return nil
+}
+
+func (g *game) PendingTakeback() int {
+	return g.TakebackRequester
+}
@@ -0,0 +1,94 @@
+package connect4
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUndo(t *testing.T) {
+	t.Run("movements", func(t *testing.T) {
+		g := newTestGame(DefaultOptions(), 4, 4, 3)
+		before := g.Board.toSlice()
+		require.NoError(t, g.Move(5))
+		require.NoError(t, g.Undo())
+
+		assert.Equal(t, before, g.Board.toSlice())
+		assert.Equal(t, Player2, g.Turn)
+		assert.Equal(t, 3, g.LastMovement)
+		assert.Len(t, g.History(), 3)
+	})
+
+	t.Run("winning movement", func(t *testing.T) {
+		g := newTestGame(DefaultOptions(), 1, 2, 1, 2, 1, 2, 1)
+		require.Equal(t, OutcomePlayer1Win, g.Outcome())
+		require.NoError(t, g.Undo())
+
+		assert.Equal(t, OutcomeNoOutcome, g.Outcome())
+		assert.Empty(t, g.WinningLines())
+		assert.Equal(t, Player1, g.Turn)
+	})
+
+	t.Run("pops", func(t *testing.T) {
+		options := DefaultOptions()
+		options.PopOut = true
+		g := newTestGame(options, 1, 2, 3)
+		before := g.Board.toSlice()
+		require.NoError(t, g.Pop(2))
+		require.NoError(t, g.Undo())
+
+		assert.Equal(t, before, g.Board.toSlice())
+		assert.Equal(t, Player2, g.Turn)
+		assert.False(t, g.LastMovementPop)
+	})
+
+	t.Run("no movements", func(t *testing.T) {
+		assert.Error(t, newTestGame(DefaultOptions()).Undo())
+	})
+}
+
+func TestTakeback(t *testing.T) {
+	g := newTestGame(DefaultOptions(), 4, 4)
+
+	assert.Error(t, g.RequestTakeback(Player1))
+	require.NoError(t, g.RequestTakeback(Player2))
+	assert.Error(t, g.AcceptTakeback(Player2))
+
+	require.NoError(t, g.DeclineTakeback(Player1))
+	assert.Equal(t, 0, g.PendingTakeback())
+	assert.Error(t, g.AcceptTakeback(Player1))
+
+	require.NoError(t, g.RequestTakeback(Player2))
+	require.NoError(t, g.AcceptTakeback(Player1))
+	assert.Len(t, g.History(), 1)
+	assert.Equal(t, Player2, g.Turn)
+
+	// A new movement cancels the request
+	require.NoError(t, g.Move(3))
+	require.NoError(t, g.RequestTakeback(Player2))
+	require.NoError(t, g.Move(3))
+	assert.Equal(t, 0, g.PendingTakeback())
+}
+
+func TestTakebackAfterFinish(t *testing.T) {
+	g := newTestGame(DefaultOptions(), 4, 4)
+	require.NoError(t, g.RequestTakeback(Player2))
+	require.NoError(t, g.Resign(Player1))
+	assert.Equal(t, 0, g.PendingTakeback())
+
+	// A request left over from before the game finished cannot be accepted
+	g.TakebackRequester = Player2
+	assert.EqualError(t, g.AcceptTakeback(Player1), "the game has finished")
+	assert.EqualError(t, g.DeclineTakeback(Player1), "the game has finished")
+	assert.Equal(t, OutcomePlayer1Resign, g.Outcome())
+	assert.Len(t, g.History(), 2)
+
+	g = newTestGame(DefaultOptions(), 4, 4)
+	require.NoError(t, g.RequestTakeback(Player2))
+	require.NoError(t, g.OfferDraw(Player1))
+	require.NoError(t, g.AcceptDraw(Player2))
+	assert.Equal(t, 0, g.PendingTakeback())
+	assert.Error(t, g.AcceptTakeback(Player1))
+	assert.Equal(t, OutcomeAgreedDraw, g.Outcome())
+}
@@ -1,9 +1,19 @@
 package connect4
 
-func (b board) GetValidMovements() []int {
+func (b *board) GetValidMovements() []int {
 	out := []int{}
-	for i, column := range b {
-		if column[0] == 0 {
+	for i, h := range b.heights {
+		if h < b.rows {
+			out = append(out, i+1)
+		}
+	}
+	return out
+}
+
+func (b *board) GetValidPops(player int) []int {
+	out := []int{}
+	for i := 0; i < b.columns; i++ {
+		if b.at(i, 0) == player {
 			out = append(out, i+1)
 		}
 	}
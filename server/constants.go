@@ -5,11 +5,28 @@ const (
 	DialogPathMove   = "/move"
 	DialogPathResign = "/resign"
 
-	AttachmentPath       = "/attachment"
-	AttachmentPathMove   = "/move"
-	AttachmentPathResign = "/resign"
+	AttachmentPath                = "/attachment"
+	AttachmentPathMove            = "/move"
+	AttachmentPathColumn          = "/column"
+	AttachmentPathResign          = "/resign"
+	AttachmentPathTakeback        = "/takeback"
+	AttachmentPathTakebackAccept  = "/takeback/accept"
+	AttachmentPathTakebackDecline = "/takeback/decline"
+	AttachmentPathDraw            = "/draw"
+	AttachmentPathDrawAccept      = "/draw/accept"
+	AttachmentPathDrawDecline     = "/draw/decline"
+	AttachmentPathRematch         = "/rematch"
+
+	AttachmentPathInvitationAccept  = "/invitation/accept"
+	AttachmentPathInvitationDecline = "/invitation/decline"
 
 	ImagePath = "/image"
 
+	PopMovementPrefix = "pop"
+
+	// MaxColumnButtons is the widest board with one button per column in
+	// the game post. Wider boards use the move dialog.
+	MaxColumnButtons = 8
+
 	AchievementNameWinner = "Winner"
 )
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/larkox/mattermost-plugin-connect4/server/connect4"
+)
+
+const (
+	// GameCreated is published once a new game is stored
+	GameCreated = "game_created"
+	// MoveMade is published for each piece dropped or popped, including
+	// those of the bot
+	MoveMade = "move_made"
+	// GameFinished is published once when a game gets an outcome
+	GameFinished = "game_finished"
+	// GameAborted is published when a game was posted but could not be
+	// stored, so it will never be played
+	GameAborted = "game_aborted"
+
+	// The takeback and draw events are published when a player asks for a
+	// takeback or offers a draw, and when the opponent answers.
+	TakebackRequested = "takeback_requested"
+	TakebackAccepted  = "takeback_accepted"
+	TakebackDeclined  = "takeback_declined"
+	DrawOffered       = "draw_offered"
+	DrawAccepted      = "draw_accepted"
+	DrawDeclined      = "draw_declined"
+
+	// The challenge events are published when a challenge is answered or
+	// expires. ChallengeAccepted is published once its game is created.
+	ChallengeAccepted = "challenge_accepted"
+	ChallengeDeclined = "challenge_declined"
+	ChallengeExpired  = "challenge_expired"
+)
+
+// GameEvent is a change in the lifecycle of a game or a challenge.
+type GameEvent struct {
+	Type string
+	// Game is the game after the change. On challenge events, it is only
+	// set once the challenge is accepted.
+	Game connect4.Game
+	// UserID is the player who made the move, asked for the takeback,
+	// offered the draw or answered
+	UserID string
+	// Invitation is only set on challenge events
+	Invitation *Invitation
+}
+
+type GameEventHandler func(event GameEvent)
+
+// eventBus calls the handlers subscribed to each event type, in the order
+// they subscribed. Handlers run synchronously, before the action that
+// published the event returns.
+type eventBus struct {
+	lock     sync.RWMutex
+	handlers map[string][]GameEventHandler
+}
+
+func (b *eventBus) subscribe(eventType string, handler GameEventHandler) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.handlers[eventType] = append(b.handlers[eventType], handler)
+}
+
+func (b *eventBus) publish(event GameEvent) {
+	b.lock.RLock()
+	handlers := b.handlers[event.Type]
+	b.lock.RUnlock()
+
+	for _, handler := range handlers {
+		handler(event)
+	}
+}
+
+// Subscribe calls the handler every time an event of the type is published.
+func (gm *GameManager) Subscribe(eventType string, handler GameEventHandler) {
+	gm.events.subscribe(eventType, handler)
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/larkox/mattermost-plugin-connect4/server/connect4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGameEvents(t *testing.T) {
+	gm := newTestGameManager(NewMemoryGameStore())
+	events := []string{}
+	for _, eventType := range []string{GameCreated, MoveMade, GameFinished, GameAborted} {
+		gm.Subscribe(eventType, func(event GameEvent) {
+			events = append(events, event.Type+" "+event.UserID)
+		})
+	}
+
+	// The last move finishes the game
+	playGame(t, gm, "player1", "player2", 1, 2, 1, 2, 1, 2, 1)
+	assert.Equal(t, []string{
+		"game_created ",
+		"move_made player1",
+		"move_made player2",
+		"move_made player1",
+		"move_made player2",
+		"move_made player1",
+		"move_made player2",
+		"move_made player1",
+		"game_finished ",
+	}, events)
+
+	// Actions that do not change the game publish nothing
+	events = []string{}
+	game := playGame(t, gm, "player1", "player2", 1)
+	require.NoError(t, gm.OfferDraw(game.GetID(), "player2"))
+	require.NoError(t, gm.DeclineDraw(game.GetID(), "player1"))
+	_, err := gm.Resign(game.GetID(), "player1")
+	require.NoError(t, err)
+	_, err = gm.Resign(game.GetID(), "player2")
+	require.Error(t, err)
+	assert.Equal(t, []string{"game_created ", "move_made player1", "game_finished "}, events)
+
+	// The bot answers are published too
+	events = []string{}
+	options := connect4.DefaultOptions()
+	options.BotLevel = connect4.BotLevelEasy
+	options.FirstPlayer = connect4.Player1
+	game, err = gm.CreateGame("player1", "bot", "channel", options)
+	require.NoError(t, err)
+	_, err = gm.Move(game.GetID(), "player1", 4)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"game_created ", "move_made player1", "move_made bot"}, events)
+
+	// Each movement of an update is published
+	events = []string{}
+	game = playGame(t, gm, "player1", "player2")
+	_, err = gm.updateGame(game.GetID(), func(game connect4.Game) error {
+		require.NoError(t, game.Move(1))
+		return game.Move(2)
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"game_created ", "move_made player1", "move_made player2"}, events)
+}
+
+func TestGameFinishedOnce(t *testing.T) {
+	gm := newTestGameManager(NewMemoryGameStore())
+	finished := 0
+	gm.Subscribe(GameFinished, func(event GameEvent) {
+		finished++
+		assert.Equal(t, connect4.OutcomePlayer2Resign, event.Game.Outcome())
+	})
+
+	game := playGame(t, gm, "player1", "player2")
+	_, err := gm.Resign(game.GetID(), "player2")
+	require.NoError(t, err)
+
+	// Rendering the finished game again does not finish it again
+	gm.gameToPost(game)
+	_, err = gm.Rematch(game.GetID(), "player1")
+	require.NoError(t, err)
+	assert.Equal(t, 1, finished)
+}
+
+func TestGameAborted(t *testing.T) {
+	api := newTestAPI()
+	gm := newTestGameManagerWithAPI(api, &unsavableStore{NewMemoryGameStore()})
+	events := []string{}
+	for _, eventType := range []string{GameCreated, GameAborted} {
+		gm.Subscribe(eventType, func(event GameEvent) {
+			events = append(events, event.Type)
+		})
+	}
+
+	_, err := gm.CreateGame("player1", "player2", "channel", connect4.DefaultOptions())
+	assert.EqualError(t, err, "storage is full")
+	assert.Equal(t, []string{GameAborted}, events)
+	assert.Equal(t, []string{"The game could not be started. Please, try again."}, api.ephemeralPosts["player2"])
+}
+
+// unsavableStore fails to save any game.
+type unsavableStore struct {
+	GameStore
+}
+
+func (s *unsavableStore) Save(game connect4.Game) error {
+	return errors.New("storage is full")
+}
+
+func TestRequestEvents(t *testing.T) {
+	api := newTestAPI()
+	gm := newTestGameManagerWithAPI(api, NewMemoryGameStore())
+	events := []string{}
+	for _, eventType := range []string{TakebackRequested, TakebackAccepted, TakebackDeclined, DrawOffered, DrawAccepted, DrawDeclined} {
+		gm.Subscribe(eventType, func(event GameEvent) {
+			events = append(events, event.Type+" "+event.UserID)
+		})
+	}
+
+	game := playGame(t, gm, "player1", "player2", 4)
+	_, err := gm.RequestTakeback(game.GetID(), "player1")
+	require.NoError(t, err)
+	require.NoError(t, gm.DeclineTakeback(game.GetID(), "player2"))
+	require.NoError(t, gm.OfferDraw(game.GetID(), "player2"))
+	_, err = gm.AcceptDraw(game.GetID(), "player1")
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{
+		"takeback_requested player1",
+		"takeback_declined player2",
+		"draw_offered player2",
+		"draw_accepted player1",
+	}, events)
+
+	// The notifications subscribe to the events. Requests are sent as
+	// attachments, without message.
+	assert.Equal(t, []string{"player2 declined your takeback request.", ""}, api.ephemeralPosts["player1"])
+	assert.Equal(t, []string{"", "player1 accepted your draw offer."}, api.ephemeralPosts["player2"])
+}
@@ -4,6 +4,8 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/larkox/mattermost-plugin-connect4/server/connect4"
 	"github.com/mattermost/mattermost-server/v5/model"
@@ -15,119 +17,436 @@ const (
 	blackTag   = "black"
 	channelTag = "channel"
 	postTag    = "post"
+
+	// maxUpdateAttempts is the number of times an update is retried when
+	// someone else changes the same data in the meantime.
+	maxUpdateAttempts = 10
+)
+
+var (
+	// errGameChanged is returned by updates that no longer apply to the stored game.
+	errGameChanged = errors.New("the game has changed")
+	// errTooManyUpdates is returned when an update keeps conflicting with others.
+	errTooManyUpdates = errors.New("too many simultaneous updates, please try again")
 )
 
+// retryUpdate calls attempt until it is done, up to maxUpdateAttempts times.
+// Attempts are not done when someone else changed the data they read.
+func retryUpdate(attempt func() (done bool, err error)) error {
+	for i := 0; i < maxUpdateAttempts; i++ {
+		done, err := attempt()
+		if err != nil || done {
+			return err
+		}
+	}
+
+	return errTooManyUpdates
+}
+
 type GameManager struct {
 	api              plugin.API
+	store            GameStore
 	botID            string
-	grantAchievement func(name string, userID string)
 	getAttachmentURL func() string
 	getImageURL      func(id string) string
+	events           eventBus
 }
 
 func NewGameManager(
 	api plugin.API,
+	store GameStore,
 	botID string,
-	grantAchievement func(name string, userID string),
 	getAttachmentURL func() string,
 	getImageURL func(id string) string,
-) GameManager {
-	return GameManager{
+) *GameManager {
+	gm := &GameManager{
 		api:              api,
+		store:            store,
 		botID:            botID,
-		grantAchievement: grantAchievement,
 		getAttachmentURL: getAttachmentURL,
 		getImageURL:      getImageURL,
+		events:           eventBus{handlers: map[string][]GameEventHandler{}},
+	}
+	gm.Subscribe(GameFinished, gm.recordResults)
+	gm.Subscribe(GameAborted, gm.notifyAborted)
+	for _, eventType := range []string{TakebackRequested, TakebackAccepted, TakebackDeclined, DrawOffered, DrawAccepted, DrawDeclined} {
+		gm.Subscribe(eventType, gm.notifyRequest)
 	}
+	for _, eventType := range []string{ChallengeAccepted, ChallengeDeclined, ChallengeExpired} {
+		gm.Subscribe(eventType, gm.notifyChallenge)
+	}
+	return gm
 }
 
-func (gm *GameManager) CreateGame(playerA, playerB string) error {
-	c, appErr := gm.api.GetDirectChannel(playerA, playerB)
-	if appErr != nil {
-		return appErr
+// CreateGame starts a game in the channel so everyone in it can watch. If
+// the channel is a direct channel or any of the players is not a member of
+// it, the game is played in the direct channel between the players instead.
+func (gm *GameManager) CreateGame(playerA, playerB, channelID string, options connect4.Options) (connect4.Game, error) {
+	return gm.createGame(model.NewId(), playerA, playerB, channelID, options)
+}
+
+func (gm *GameManager) createGame(id, playerA, playerB, channelID string, options connect4.Options) (connect4.Game, error) {
+	err := options.Validate()
+	if err != nil {
+		return nil, err
 	}
 
-	originalGame := gm.getGame(c.Id)
-	if originalGame != nil {
-		if originalGame.Outcome() == connect4.OutcomeNoOutcome {
-			return errors.New("still an active game")
-		}
+	if (playerB == gm.botID) != (options.BotLevel != connect4.BotLevelNone) {
+		return nil, errors.New("only games against the bot have a bot level")
+	}
+
+	channelID, err = gm.gameChannel(channelID, playerA, playerB)
+	if err != nil {
+		return nil, err
 	}
 
-	game := connect4.NewGame(playerA, playerB, c.Id)
+	game := connect4.NewGame(id, playerA, playerB, channelID, options)
+	gm.playBot(game)
+	game.SetDescription(gm.headToHeadDescription(game))
 
 	post, appErr := gm.api.CreatePost(gm.gameToPost(game))
 	if appErr != nil {
-		return appErr
+		return nil, appErr
 	}
 
 	game.SetPostID(post.Id)
-	gm.saveGame(game)
-	return nil
+	err = gm.store.Save(game)
+	if err != nil {
+		gm.events.publish(GameEvent{Type: GameAborted, Game: game})
+		return nil, err
+	}
+
+	gm.events.publish(GameEvent{Type: GameCreated, Game: game})
+	return game, nil
 }
 
-func (gm *GameManager) Move(id, player string, movement int) (*model.Post, error) {
-	game := gm.getGame(id)
-	if game == nil {
-		return nil, errors.New("no game started")
+// Rematch starts a new game between the players of the finished game, with
+// the same options and in the same channel. The player who moved second in
+// the finished game moves first in the rematch. It returns the post of the
+// finished game, which no longer offers the rematch.
+func (gm *GameManager) Rematch(id, userID string) (*model.Post, error) {
+	rematchID := model.NewId()
+	game, err := gm.updateGame(id, func(game connect4.Game) error {
+		if playerNumber(game, userID) == 0 {
+			return errors.New("you are not playing")
+		}
+
+		return game.SetRematchID(rematchID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	options := game.GetOptions()
+	options.FirstPlayer = options.FirstPlayer%2 + 1
+	channelID, _, player1, player2 := game.GetMetadata()
+	_, err = gm.createGame(rematchID, player1, player2, channelID, options)
+	if err != nil {
+		// Let the players ask for a rematch again
+		_, clearErr := gm.updateGame(id, func(game connect4.Game) error {
+			if game.RematchID() != rematchID {
+				return errGameChanged
+			}
+			game.ClearRematchID(rematchID)
+			return nil
+		})
+		if clearErr != nil && clearErr != errGameChanged {
+			gm.api.LogError("could not clear the rematch", "game", id, "error", clearErr.Error())
+		}
+		return nil, err
+	}
+
+	return gm.gameToPost(game), nil
+}
+
+// gameChannel returns the channel where the players play: the given one if
+// they can play there, or their direct channel otherwise.
+func (gm *GameManager) gameChannel(channelID, playerA, playerB string) (string, error) {
+	if gm.canPlayInChannel(channelID, playerA, playerB) {
+		return channelID, nil
 	}
 
-	turn := game.GetTurnPlayer()
-	if player != turn {
-		return nil, errors.New("it is not your turn")
+	c, appErr := gm.api.GetDirectChannel(playerA, playerB)
+	if appErr != nil {
+		return "", appErr
+	}
+	return c.Id, nil
+}
+
+func (gm *GameManager) canPlayInChannel(channelID, playerA, playerB string) bool {
+	if channelID == "" {
+		return false
 	}
 
-	err := game.Move(movement)
+	c, appErr := gm.api.GetChannel(channelID)
+	if appErr != nil || c.Type == model.CHANNEL_DIRECT {
+		return false
+	}
+
+	for _, player := range []string{playerA, playerB} {
+		_, appErr = gm.api.GetChannelMember(channelID, player)
+		if appErr != nil {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (gm *GameManager) Move(id, player string, movement int) (*model.Post, error) {
+	return gm.play(id, player, func(game connect4.Game) error {
+		return game.Move(movement)
+	})
+}
+
+func (gm *GameManager) Pop(id, player string, column int) (*model.Post, error) {
+	return gm.play(id, player, func(game connect4.Game) error {
+		return game.Pop(column)
+	})
+}
+
+func (gm *GameManager) play(id, player string, movement func(game connect4.Game) error) (*model.Post, error) {
+	game, err := gm.updateGame(id, func(game connect4.Game) error {
+		if game.Outcome() != connect4.OutcomeNoOutcome {
+			return errors.New("the game has finished")
+		}
+
+		if player != game.GetTurnPlayer() {
+			return errors.New("it is not your turn")
+		}
+
+		return movement(game)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	game, err = gm.answerBot(game)
 	if err != nil {
 		return nil, err
 	}
 
-	gm.saveGame(game)
 	return gm.gameToPost(game), nil
 }
 
 func (gm *GameManager) Resign(id, player string) (*model.Post, error) {
-	game := gm.getGame(id)
+	game, err := gm.updateGame(id, func(game connect4.Game) error {
+		number := playerNumber(game, player)
+		if number == 0 {
+			return errors.New("you are not playing")
+		}
+
+		return game.Resign(number)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return gm.gameToPost(game), nil
+}
+
+// answerBot makes the bot move in the stored game if it is its turn. The
+// movement is chosen outside of the update, so conflicting updates do not
+// repeat the search. It is chosen again if the game changed meanwhile.
+func (gm *GameManager) answerBot(game connect4.Game) (connect4.Game, error) {
+	err := retryUpdate(func() (bool, error) {
+		if game.Outcome() != connect4.OutcomeNoOutcome || game.GetTurnPlayer() != gm.botID {
+			return true, nil
+		}
+
+		history := game.History()
+		column, err := connect4.BotMove(game)
+		if err != nil {
+			gm.api.LogError("bot could not choose a movement", "error", err.Error())
+			return true, nil
+		}
+
+		updated, err := gm.updateGame(game.GetID(), func(current connect4.Game) error {
+			if current.Outcome() != connect4.OutcomeNoOutcome || !sameMovements(current.History(), history) {
+				return errGameChanged
+			}
+			return current.Move(column)
+		})
+		if err == errGameChanged {
+			game, err = gm.getGame(game.GetID())
+			return false, err
+		}
+		if err != nil {
+			return false, err
+		}
+
+		game = updated
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return game, nil
+}
+
+// sameMovements tells if both histories have the same movements, ignoring
+// when they were played.
+func sameMovements(a, b []connect4.Movement) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Player != b[i].Player || a[i].Column != b[i].Column || a[i].Pop != b[i].Pop {
+			return false
+		}
+	}
+	return true
+}
+
+// playBot makes the bot move if it is playing the game and it is its turn.
+// It is only used on games that are not stored yet.
+func (gm *GameManager) playBot(game connect4.Game) {
+	if game.Outcome() != connect4.OutcomeNoOutcome || game.GetTurnPlayer() != gm.botID {
+		return
+	}
+
+	column, err := connect4.BotMove(game)
+	if err != nil {
+		gm.api.LogError("bot could not choose a movement", "error", err.Error())
+		return
+	}
+
+	err = game.Move(column)
+	if err != nil {
+		gm.api.LogError("bot could not move", "column", column, "error", err.Error())
+	}
+}
+
+// playerNumber returns the player the user is in the game, or 0 if the user is not playing it.
+func playerNumber(game connect4.Game, userID string) int {
+	_, _, player1, player2 := game.GetMetadata()
+	switch userID {
+	case player1:
+		return connect4.Player1
+	case player2:
+		return connect4.Player2
+	}
+	return 0
+}
+
+func (gm *GameManager) getGame(id string) (connect4.Game, error) {
+	game, err := gm.store.Get(id)
+	if err != nil {
+		return nil, err
+	}
 	if game == nil {
 		return nil, errors.New("no game started")
 	}
 
-	_, _, player1, player2 := gm.getGameMetadata(game)
+	return game, nil
+}
 
-	switch player {
-	case player1.Id:
-		game.Resign(connect4.Player1)
-	case player2.Id:
-		game.Resign(connect4.Player2)
-	default:
-		return nil, errors.New("you are not playing")
+// updateGame applies the update to the stored game and saves it, so that
+// concurrent updates of the same game, even from other servers of the
+// cluster, never overwrite each other. The update may run several times,
+// always on the latest version of the game.
+func (gm *GameManager) updateGame(id string, update func(game connect4.Game) error) (connect4.Game, error) {
+	var game connect4.Game
+	err := retryUpdate(func() (bool, error) {
+		old, err := gm.getGame(id)
+		if err != nil {
+			return false, err
+		}
+
+		// Update a copy, so the stored game can still be compared with old
+		game, err = connect4.GameFromJSON(old.ToJSON())
+		if err != nil {
+			return false, err
+		}
+
+		err = update(game)
+		if err != nil {
+			return false, err
+		}
+
+		ok, err := gm.store.CompareAndSet(old, game)
+		if err != nil || !ok {
+			return false, err
+		}
+
+		gm.publishChanges(old, game)
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	gm.saveGame(game)
-	return gm.gameToPost(game), nil
+	return game, nil
 }
 
-func (gm *GameManager) getGame(id string) connect4.Game {
-	b, appErr := gm.api.KVGet(id)
-	if appErr != nil {
-		return nil
+// publishChanges publishes the events of the update from old to game.
+func (gm *GameManager) publishChanges(old, game connect4.Game) {
+	_, _, player1, player2 := game.GetMetadata()
+	history := game.History()
+	for i := len(old.History()); i < len(history); i++ {
+		userID := player1
+		if history[i].Player == connect4.Player2 {
+			userID = player2
+		}
+		gm.events.publish(GameEvent{Type: MoveMade, Game: game, UserID: userID})
+	}
+	if old.Outcome() == connect4.OutcomeNoOutcome && game.Outcome() != connect4.OutcomeNoOutcome {
+		gm.events.publish(GameEvent{Type: GameFinished, Game: game})
 	}
+}
 
-	game, err := connect4.GameFromJSON(b)
+// recordResults updates the statistics, ratings, leaderboards and head to
+// head records with the finished game.
+func (gm *GameManager) recordResults(event GameEvent) {
+	game := event.Game
+	err := gm.updateStats(game)
 	if err != nil {
-		return nil
+		gm.api.LogError("could not update the stats", "game", game.GetID(), "error", err.Error())
 	}
 
-	return game
+	if game.GetOptions().Ranked {
+		err = gm.updateRatings(game)
+		if err != nil {
+			gm.api.LogError("could not update the ratings", "game", game.GetID(), "error", err.Error())
+		}
+	}
+
+	err = gm.updateLeaderboards(game)
+	if err != nil {
+		gm.api.LogError("could not update the leaderboards", "game", game.GetID(), "error", err.Error())
+	}
+
+	err = gm.updateHeadToHead(game)
+	if err != nil {
+		gm.api.LogError("could not update the head to head record", "game", game.GetID(), "error", err.Error())
+	}
 }
 
-func (gm *GameManager) saveGame(game connect4.Game) {
-	id, _, _, _ := gm.getGameMetadata(game)
-	_ = gm.api.KVSet(id, game.ToJSON())
+// notifyAborted removes the post of a game that could not be stored, and
+// tells the players the game did not start.
+func (gm *GameManager) notifyAborted(event GameEvent) {
+	channelID, postID, player1, player2 := event.Game.GetMetadata()
+	appErr := gm.api.DeletePost(postID)
+	if appErr != nil {
+		gm.api.LogError("could not delete the post of the aborted game", "game", event.Game.GetID(), "error", appErr.Error())
+	}
+
+	for _, userID := range []string{player1, player2} {
+		if userID == gm.botID {
+			continue
+		}
+		gm.api.SendEphemeralPost(userID, &model.Post{
+			ChannelId: channelID,
+			UserId:    gm.botID,
+			Message:   "The game could not be started. Please, try again.",
+		})
+	}
 }
 
 func (gm *GameManager) gameToPost(game connect4.Game) *model.Post {
 	channelID, postID, player1, player2 := gm.getGameMetadata(game)
+	gameID := game.GetID()
 
 	post := &model.Post{
 		Id:        postID,
@@ -144,44 +463,107 @@ func (gm *GameManager) gameToPost(game connect4.Game) *model.Post {
 		turn = player2.Username
 	}
 
+	options := game.GetOptions()
 	attachment := &model.SlackAttachment{
-		Title:    "Connect4 game",
-		ImageURL: gm.getImageURL(channelID),
-		Text:     fmt.Sprintf("Player1: %s\nPlayer2: %s\nTurn: %s", player1.Username, player2.Username, turn),
+		Title:    fmt.Sprintf("Connect%d game", options.WinLength),
+		ImageURL: gm.getImageURL(gameID),
+		Text: fmt.Sprintf(
+			"Player1: %s\nPlayer2: %s\nTurn: %s\nBoard: %dx%d, %d in a row to win",
+			player1.Username,
+			player2.Username,
+			turn,
+			options.Columns,
+			options.Rows,
+			options.WinLength,
+		),
+	}
+	if options.PopOut {
+		attachment.Text += "\nPopOut: you may remove your own pieces from the bottom row"
+	}
+	if options.Ranked {
+		attachment.Text += "\nRanked game"
+	}
+	if game.GetDescription() != "" {
+		attachment.Text += "\n" + game.GetDescription()
 	}
 
 	switch game.Outcome() {
 	case connect4.OutcomeNoOutcome:
-		attachment.Actions = []*model.PostAction{
-			{
+		attachment.Actions = []*model.PostAction{}
+		if options.Columns <= MaxColumnButtons {
+			for _, column := range game.ValidMovements() {
+				attachment.Actions = append(attachment.Actions, &model.PostAction{
+					Type: "button",
+					Name: strconv.Itoa(column),
+					Integration: &model.PostActionIntegration{
+						URL: gm.getAttachmentURL() + AttachmentPathColumn + "/" + gameID + "/" + strconv.Itoa(column),
+					},
+				})
+			}
+		}
+		if options.Columns > MaxColumnButtons || options.PopOut {
+			// The dialog also lists the pops
+			attachment.Actions = append(attachment.Actions, &model.PostAction{
 				Type: "button",
 				Name: "Move",
 				Integration: &model.PostActionIntegration{
-					URL: gm.getAttachmentURL() + AttachmentPathMove + "/" + channelID,
+					URL: gm.getAttachmentURL() + AttachmentPathMove + "/" + gameID,
 				},
+			})
+		}
+		attachment.Actions = append(attachment.Actions, &model.PostAction{
+			Type: "button",
+			Name: "Resign",
+			Integration: &model.PostActionIntegration{
+				URL: gm.getAttachmentURL() + AttachmentPathResign + "/" + gameID,
 			},
-			{
+		})
+		if len(game.History()) > 0 {
+			attachment.Actions = append(attachment.Actions, &model.PostAction{
 				Type: "button",
-				Name: "Resign",
+				Name: "Request takeback",
 				Integration: &model.PostActionIntegration{
-					URL: gm.getAttachmentURL() + AttachmentPathResign + "/" + channelID,
+					URL: gm.getAttachmentURL() + AttachmentPathTakeback + "/" + gameID,
 				},
-			},
+			})
+		}
+		if options.BotLevel == connect4.BotLevelNone {
+			attachment.Actions = append(attachment.Actions, &model.PostAction{
+				Type: "button",
+				Name: "Offer draw",
+				Integration: &model.PostActionIntegration{
+					URL: gm.getAttachmentURL() + AttachmentPathDraw + "/" + gameID,
+				},
+			})
 		}
 	case connect4.OutcomePlayer1Win:
-		gm.grantAchievement(AchievementNameWinner, player1.Id)
 		attachment.Footer = "Player1 won!"
 	case connect4.OutcomePlayer2Win:
-		gm.grantAchievement(AchievementNameWinner, player2.Id)
 		attachment.Footer = "Player2 won!"
 	case connect4.OutcomePlayer1Resign:
-		gm.grantAchievement(AchievementNameWinner, player2.Id)
 		attachment.Footer = "Player2 won because player 1 resigned!"
 	case connect4.OutcomePlayer2Resign:
-		gm.grantAchievement(AchievementNameWinner, player1.Id)
 		attachment.Footer = "Player1 won because Player2 resigned!"
 	case connect4.OutcomeDraw:
 		attachment.Footer = "Draw!"
+	case connect4.OutcomeAgreedDraw:
+		attachment.Footer = "Draw by agreement!"
+	}
+
+	if game.Outcome() != connect4.OutcomeNoOutcome {
+		if game.RematchID() == "" {
+			attachment.Actions = []*model.PostAction{
+				{
+					Type: "button",
+					Name: "Rematch",
+					Integration: &model.PostActionIntegration{
+						URL: gm.getAttachmentURL() + AttachmentPathRematch + "/" + gameID,
+					},
+				},
+			}
+		} else {
+			attachment.Footer += " A rematch has started."
+		}
 	}
 
 	model.ParseSlackAttachment(post, []*model.SlackAttachment{attachment})
@@ -203,29 +585,69 @@ func (gm *GameManager) getGameMetadata(game connect4.Game) (string, string, *mod
 	return id, postID, player1, player2
 }
 
-func (gm *GameManager) CanMove(id, player string) bool {
-	g := gm.getGame(id)
-	if g == nil {
-		return false
+// ListGames returns the active games of the user, oldest first.
+func (gm *GameManager) ListGames(userID string) ([]connect4.Game, error) {
+	return gm.store.ListByUser(userID)
+}
+
+// FindGame returns the active game of the user whose ID starts with gameID.
+// Without gameID, it returns the only active game of the user in the
+// channel, or else the only active game of the user.
+func (gm *GameManager) FindGame(userID, channelID, gameID string) (connect4.Game, error) {
+	games, err := gm.store.ListByUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(games) == 0 {
+		return nil, errors.New("you have no active games")
+	}
+
+	matches := []connect4.Game{}
+	for _, game := range games {
+		gameChannelID, _, _, _ := game.GetMetadata()
+		if gameID != "" && strings.HasPrefix(game.GetID(), gameID) || gameID == "" && gameChannelID == channelID {
+			matches = append(matches, game)
+		}
+	}
+	if gameID == "" && len(matches) == 0 {
+		matches = games
 	}
 
-	return g.GetTurnPlayer() == player
+	switch {
+	case len(matches) == 1:
+		return matches[0], nil
+	case gameID == "":
+		return nil, errors.New("you have several active games, choose one with its ID from /connect4 list")
+	case len(matches) == 0:
+		return nil, fmt.Errorf("none of your active games has the ID %s", gameID)
+	default:
+		return nil, fmt.Errorf("several of your active games have an ID starting with %s", gameID)
+	}
 }
 
-func (gm *GameManager) IsPlayingGame(id, player string) bool {
-	g := gm.getGame(id)
-	if g == nil {
-		return false
+func (gm *GameManager) CanMove(id, player string) (bool, error) {
+	g, err := gm.getGame(id)
+	if err != nil {
+		return false, err
 	}
 
-	_, _, player1, player2 := gm.getGameMetadata(g)
+	return g.GetTurnPlayer() == player, nil
+}
 
-	return player1.Id == player || player2.Id == player
+func (gm *GameManager) IsPlayingGame(id, player string) (bool, error) {
+	g, err := gm.getGame(id)
+	if err != nil {
+		return false, err
+	}
+
+	return playerNumber(g, player) != 0, nil
 }
 
 func (gm *GameManager) PrintImage(w http.ResponseWriter, id string) {
-	g := gm.getGame(id)
-	if g == nil {
+	g, err := gm.getGame(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
 		return
 	}
 
@@ -234,10 +656,19 @@ func (gm *GameManager) PrintImage(w http.ResponseWriter, id string) {
 }
 
 func (gm *GameManager) ValidMovements(id string) []int {
-	g := gm.getGame(id)
-	if g == nil {
+	g, err := gm.getGame(id)
+	if err != nil {
 		return nil
 	}
 
 	return g.ValidMovements()
 }
+
+func (gm *GameManager) ValidPops(id string) []int {
+	g, err := gm.getGame(id)
+	if err != nil {
+		return nil
+	}
+
+	return g.ValidPops()
+}
@@ -0,0 +1,489 @@
+package main
+
+import (
+	"bytes"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/larkox/mattermost-plugin-connect4/server/connect4"
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/mattermost/mattermost-server/v5/plugin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testAPI implements the parts of the plugin API used by the game manager,
+// keeping the KV store in memory.
+type testAPI struct {
+	plugin.API
+	lock sync.Mutex
+	kv   map[string][]byte
+	// ephemeralPosts has the messages of the ephemeral posts sent to each user
+	ephemeralPosts map[string][]string
+	deletedPosts   []string
+	// users are the users found by username
+	users map[string]*model.User
+}
+
+func newTestAPI() *testAPI {
+	return &testAPI{
+		kv:             map[string][]byte{},
+		ephemeralPosts: map[string][]string{},
+		users:          map[string]*model.User{},
+	}
+}
+
+func (a *testAPI) KVGet(key string) ([]byte, *model.AppError) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return a.kv[key], nil
+}
+
+func (a *testAPI) KVSet(key string, value []byte) *model.AppError {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.kv[key] = value
+	return nil
+}
+
+func (a *testAPI) KVCompareAndSet(key string, oldValue, newValue []byte) (bool, *model.AppError) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	current, ok := a.kv[key]
+	if ok != (oldValue != nil) || !bytes.Equal(current, oldValue) {
+		return false, nil
+	}
+	a.kv[key] = newValue
+	return true, nil
+}
+
+func (a *testAPI) KVDelete(key string) *model.AppError {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	delete(a.kv, key)
+	return nil
+}
+
+func (a *testAPI) GetUser(userID string) (*model.User, *model.AppError) {
+	return &model.User{Id: userID, Username: userID}, nil
+}
+
+func (a *testAPI) GetUserByUsername(username string) (*model.User, *model.AppError) {
+	user, ok := a.users[username]
+	if !ok {
+		return nil, model.NewAppError("GetUserByUsername", "not_found", nil, "", http.StatusNotFound)
+	}
+	return user, nil
+}
+
+func (a *testAPI) GetChannel(channelID string) (*model.Channel, *model.AppError) {
+	if strings.Contains(channelID, "__") {
+		return &model.Channel{Id: channelID, Type: model.CHANNEL_DIRECT}, nil
+	}
+	return &model.Channel{Id: channelID, Name: channelID, TeamId: "team", Type: model.CHANNEL_OPEN}, nil
+}
+
+func (a *testAPI) GetTeam(teamID string) (*model.Team, *model.AppError) {
+	return &model.Team{Id: teamID, Name: teamID}, nil
+}
+
+// GetTeamsForUser returns the teams "team" and "other", except for users
+// starting with "outsider", who are only in "other".
+func (a *testAPI) GetTeamsForUser(userID string) ([]*model.Team, *model.AppError) {
+	if strings.HasPrefix(userID, "outsider") {
+		return []*model.Team{{Id: "other"}}, nil
+	}
+	return []*model.Team{{Id: "team"}, {Id: "other"}}, nil
+}
+
+func (a *testAPI) GetTeamMember(teamID, userID string) (*model.TeamMember, *model.AppError) {
+	if strings.HasPrefix(userID, "outsider") && teamID != "other" {
+		return nil, model.NewAppError("GetTeamMember", "not_found", nil, "", 404)
+	}
+	return &model.TeamMember{TeamId: teamID, UserId: userID}, nil
+}
+
+func (a *testAPI) GetChannelMember(channelID, userID string) (*model.ChannelMember, *model.AppError) {
+	return &model.ChannelMember{ChannelId: channelID, UserId: userID}, nil
+}
+
+func (a *testAPI) GetDirectChannel(userID1, userID2 string) (*model.Channel, *model.AppError) {
+	return &model.Channel{Id: model.GetDMNameFromIds(userID1, userID2), Type: model.CHANNEL_DIRECT}, nil
+}
+
+func (a *testAPI) CreatePost(post *model.Post) (*model.Post, *model.AppError) {
+	post.Id = model.NewId()
+	return post, nil
+}
+
+func (a *testAPI) UpdatePost(post *model.Post) (*model.Post, *model.AppError) {
+	return post, nil
+}
+
+func (a *testAPI) DeletePost(postID string) *model.AppError {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.deletedPosts = append(a.deletedPosts, postID)
+	return nil
+}
+
+func (a *testAPI) SendEphemeralPost(userID string, post *model.Post) *model.Post {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.ephemeralPosts[userID] = append(a.ephemeralPosts[userID], post.Message)
+	return post
+}
+
+func (a *testAPI) LogError(msg string, keyValuePairs ...interface{}) {}
+
+// testStores returns a new store of each implementation.
+func testStores() map[string]GameStore {
+	return map[string]GameStore{
+		"kv":     NewKVGameStore(newTestAPI()),
+		"memory": NewMemoryGameStore(),
+	}
+}
+
+func newTestGameManager(store GameStore) *GameManager {
+	return newTestGameManagerWithAPI(newTestAPI(), store)
+}
+
+func newTestGameManagerWithAPI(api plugin.API, store GameStore) *GameManager {
+	return NewGameManager(
+		api,
+		store,
+		"bot",
+		func() string { return "" },
+		func(id string) string { return "" },
+	)
+}
+
+func TestConcurrentMoves(t *testing.T) {
+	for name, store := range testStores() {
+		t.Run(name, func(t *testing.T) {
+			gm := newTestGameManager(store)
+			options := connect4.DefaultOptions()
+			options.Columns = connect4.MaxColumns
+			options.Rows = connect4.MaxRows
+			game := connect4.NewGame(model.NewId(), "player1", "player2", "channel", options)
+			require.NoError(t, store.Save(game))
+
+			var moves int64
+			var wg sync.WaitGroup
+			for i := 0; i < 20; i++ {
+				wg.Add(1)
+				go func(player string) {
+					defer wg.Done()
+					for j := 0; j < 50; j++ {
+						_, err := gm.Move(game.GetID(), player, rand.Intn(options.Columns)+1)
+						if err == nil {
+							atomic.AddInt64(&moves, 1)
+						}
+					}
+				}([]string{"player1", "player2"}[i%2])
+			}
+			wg.Wait()
+
+			stored, err := gm.getGame(game.GetID())
+			require.NoError(t, err)
+			history := stored.History()
+			require.NotEmpty(t, history)
+			assert.Len(t, history, int(moves))
+			for i := 1; i < len(history); i++ {
+				assert.NotEqual(t, history[i-1].Player, history[i].Player, "players must alternate")
+			}
+		})
+	}
+}
+
+func TestConcurrentResignations(t *testing.T) {
+	for name, store := range testStores() {
+		t.Run(name, func(t *testing.T) {
+			gm := newTestGameManager(store)
+			game := connect4.NewGame(model.NewId(), "player1", "player2", "channel", connect4.DefaultOptions())
+			require.NoError(t, store.Save(game))
+
+			var resignations int64
+			var wg sync.WaitGroup
+			for i := 0; i < 20; i++ {
+				wg.Add(1)
+				go func(player string) {
+					defer wg.Done()
+					_, err := gm.Resign(game.GetID(), player)
+					if err == nil {
+						atomic.AddInt64(&resignations, 1)
+					}
+				}([]string{"player1", "player2"}[i%2])
+			}
+			wg.Wait()
+
+			assert.Equal(t, int64(1), resignations)
+			stored, err := gm.getGame(game.GetID())
+			require.NoError(t, err)
+			assert.NotEqual(t, connect4.OutcomeNoOutcome, stored.Outcome())
+		})
+	}
+}
+
+func TestBotAnswers(t *testing.T) {
+	gm := newTestGameManager(NewMemoryGameStore())
+	options := connect4.DefaultOptions()
+	options.BotLevel = connect4.BotLevelEasy
+	options.FirstPlayer = connect4.Player1
+	game, err := gm.CreateGame("player1", "bot", "channel", options)
+	require.NoError(t, err)
+
+	_, err = gm.Move(game.GetID(), "player1", 4)
+	require.NoError(t, err)
+	game, err = gm.getGame(game.GetID())
+	require.NoError(t, err)
+	require.Len(t, game.History(), 2)
+	assert.Equal(t, "player1", game.GetTurnPlayer())
+
+	// The bot answers the stored game when it changed after the search
+	stale, err := connect4.GameFromJSON(game.ToJSON())
+	require.NoError(t, err)
+	require.NoError(t, stale.Move(1))
+	_, err = gm.updateGame(game.GetID(), func(game connect4.Game) error {
+		return game.Move(7)
+	})
+	require.NoError(t, err)
+
+	game, err = gm.answerBot(stale)
+	require.NoError(t, err)
+	require.Len(t, game.History(), 4)
+	assert.Equal(t, 7, game.History()[2].Column)
+	assert.Equal(t, "player1", game.GetTurnPlayer())
+}
+
+func TestPlayAfterFinish(t *testing.T) {
+	// Both players have three pieces in a column, so the next movement in
+	// any of them completes a line
+	finish := map[string]func(t *testing.T, gm *GameManager, game connect4.Game){
+		"win": func(t *testing.T, gm *GameManager, game connect4.Game) {
+			_, err := gm.Move(game.GetID(), "player1", 1)
+			require.NoError(t, err)
+		},
+		"resignation": func(t *testing.T, gm *GameManager, game connect4.Game) {
+			_, err := gm.Resign(game.GetID(), "player2")
+			require.NoError(t, err)
+		},
+		"draw": func(t *testing.T, gm *GameManager, game connect4.Game) {
+			require.NoError(t, gm.OfferDraw(game.GetID(), "player2"))
+			_, err := gm.AcceptDraw(game.GetID(), "player1")
+			require.NoError(t, err)
+		},
+	}
+
+	for name, finishGame := range finish {
+		t.Run(name, func(t *testing.T) {
+			gm := newTestGameManager(NewMemoryGameStore())
+			finished := 0
+			gm.Subscribe(GameFinished, func(event GameEvent) {
+				finished++
+			})
+
+			options := connect4.DefaultOptions()
+			options.FirstPlayer = connect4.Player1
+			options.PopOut = true
+			game, err := gm.CreateGame("player1", "player2", "channel", options)
+			require.NoError(t, err)
+			for _, column := range []int{1, 2, 1, 2, 1, 2} {
+				game, err = gm.getGame(game.GetID())
+				require.NoError(t, err)
+				_, err = gm.Move(game.GetID(), game.GetTurnPlayer(), column)
+				require.NoError(t, err)
+			}
+			finishGame(t, gm, game)
+
+			finishedGame, err := gm.getGame(game.GetID())
+			require.NoError(t, err)
+			for _, player := range []string{"player1", "player2"} {
+				for _, column := range []int{1, 2} {
+					_, err = gm.Move(game.GetID(), player, column)
+					assert.EqualError(t, err, "the game has finished")
+					_, err = gm.Pop(game.GetID(), player, column)
+					assert.EqualError(t, err, "the game has finished")
+				}
+			}
+
+			game, err = gm.getGame(game.GetID())
+			require.NoError(t, err)
+			assert.Equal(t, finishedGame.Outcome(), game.Outcome())
+			assert.Len(t, game.History(), len(finishedGame.History()))
+			assert.Equal(t, 1, finished)
+		})
+	}
+}
+
+func TestStorageErrors(t *testing.T) {
+	gm := newTestGameManager(NewKVGameStore(&failingAPI{}))
+
+	_, err := gm.Move("id", "player1", 1)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "storage is down")
+
+	_, err = gm.IsPlayingGame("id", "player1")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "storage is down")
+}
+
+func TestIndexErrors(t *testing.T) {
+	api := &indexFailingAPI{testAPI: newTestAPI()}
+	gm := newTestGameManagerWithAPI(api, NewKVGameStore(api))
+	events := []string{}
+	for _, eventType := range []string{GameCreated, GameFinished, GameAborted} {
+		gm.Subscribe(eventType, func(event GameEvent) {
+			events = append(events, event.Type)
+		})
+	}
+
+	// The games are stored and played even if they cannot be listed
+	game := playGame(t, gm, "player1", "player2", 1, 2, 1, 2, 1, 2, 1)
+	assert.Equal(t, []string{GameCreated, GameFinished}, events)
+	game, err := gm.getGame(game.GetID())
+	require.NoError(t, err)
+	assert.Equal(t, connect4.OutcomePlayer1Win, game.Outcome())
+	assert.Empty(t, api.deletedPosts)
+
+	stats, err := gm.GetStats("player1")
+	require.NoError(t, err)
+	assert.Equal(t, 1, stats.Wins)
+}
+
+// indexFailingAPI fails to update the index of the games of each channel.
+type indexFailingAPI struct {
+	*testAPI
+}
+
+func (a *indexFailingAPI) KVCompareAndSet(key string, oldValue, newValue []byte) (bool, *model.AppError) {
+	if strings.HasPrefix(key, channelGamesKeyPrefix) {
+		return false, model.NewAppError("KVCompareAndSet", "storage is down", nil, "", http.StatusInternalServerError)
+	}
+	return a.testAPI.KVCompareAndSet(key, oldValue, newValue)
+}
+
+// failingAPI fails every KV store operation.
+type failingAPI struct {
+	plugin.API
+}
+
+func (a *failingAPI) KVGet(key string) ([]byte, *model.AppError) {
+	return nil, model.NewAppError("KVGet", "storage is down", nil, "", http.StatusInternalServerError)
+}
+
+func TestFindGame(t *testing.T) {
+	store := NewMemoryGameStore()
+	gm := newTestGameManager(store)
+
+	_, err := gm.FindGame("player1", "channel", "")
+	assert.EqualError(t, err, "you have no active games")
+
+	first := connect4.NewGame("abc1", "player1", "player2", "channel", connect4.DefaultOptions())
+	require.NoError(t, store.Save(first))
+
+	// The only game is found from any channel
+	game, err := gm.FindGame("player1", "other", "")
+	require.NoError(t, err)
+	assert.Equal(t, "abc1", game.GetID())
+
+	second := connect4.NewGame("abc2", "player1", "player3", "other", connect4.DefaultOptions())
+	require.NoError(t, store.Save(second))
+
+	game, err = gm.FindGame("player1", "other", "")
+	require.NoError(t, err)
+	assert.Equal(t, "abc2", game.GetID())
+
+	_, err = gm.FindGame("player1", "third", "")
+	assert.Error(t, err)
+
+	game, err = gm.FindGame("player1", "third", "abc1")
+	require.NoError(t, err)
+	assert.Equal(t, "abc1", game.GetID())
+
+	_, err = gm.FindGame("player1", "channel", "abc")
+	assert.Error(t, err)
+
+	_, err = gm.FindGame("player2", "channel", "abc2")
+	assert.Error(t, err)
+}
+
+func TestGameToPostActions(t *testing.T) {
+	gm := newTestGameManager(NewMemoryGameStore())
+	actionNames := func(options connect4.Options) []string {
+		game := connect4.NewGame("id", "player1", "player2", "channel", options)
+		names := []string{}
+		for _, action := range gm.gameToPost(game).Attachments()[0].Actions {
+			names = append(names, action.Name)
+		}
+		return names
+	}
+
+	assert.Equal(t, []string{"1", "2", "3", "4", "5", "6", "7", "Resign", "Offer draw"}, actionNames(connect4.DefaultOptions()))
+
+	popOut := connect4.DefaultOptions()
+	popOut.PopOut = true
+	assert.Equal(t, []string{"1", "2", "3", "4", "5", "6", "7", "Move", "Resign", "Offer draw"}, actionNames(popOut))
+
+	wide := connect4.DefaultOptions()
+	wide.Columns = connect4.MaxColumns
+	assert.Equal(t, []string{"Move", "Resign", "Offer draw"}, actionNames(wide))
+}
+
+func TestRematch(t *testing.T) {
+	store := NewMemoryGameStore()
+	gm := newTestGameManager(store)
+	options := connect4.DefaultOptions()
+	options.Columns = 8
+	options.FirstPlayer = connect4.Player2
+	game, err := gm.CreateGame("player1", "player2", "channel", options)
+	require.NoError(t, err)
+
+	_, err = gm.Rematch(game.GetID(), "player1")
+	assert.EqualError(t, err, "the game has not finished")
+
+	_, err = gm.Resign(game.GetID(), "player1")
+	require.NoError(t, err)
+
+	_, err = gm.Rematch(game.GetID(), "player3")
+	assert.EqualError(t, err, "you are not playing")
+
+	post, err := gm.Rematch(game.GetID(), "player1")
+	require.NoError(t, err)
+	assert.Empty(t, post.Attachments()[0].Actions)
+
+	_, err = gm.Rematch(game.GetID(), "player2")
+	assert.EqualError(t, err, "the rematch has already started")
+
+	finished, err := gm.getGame(game.GetID())
+	require.NoError(t, err)
+	rematch, err := gm.getGame(finished.RematchID())
+	require.NoError(t, err)
+	channelID, _, player1, player2 := rematch.GetMetadata()
+	assert.Equal(t, "channel", channelID)
+	assert.Equal(t, "player1", player1)
+	assert.Equal(t, "player2", player2)
+	assert.Equal(t, "player1", rematch.GetTurnPlayer())
+	assert.Equal(t, 8, rematch.GetOptions().Columns)
+}
+
+func TestRematchNotCreated(t *testing.T) {
+	store := NewMemoryGameStore()
+	gm := newTestGameManager(&unsavableStore{store})
+	game := connect4.NewGame("id", "player1", "player2", "channel", connect4.DefaultOptions())
+	require.NoError(t, game.Resign(connect4.Player2))
+	require.NoError(t, store.Save(game))
+
+	_, err := gm.Rematch(game.GetID(), "player1")
+	assert.EqualError(t, err, "storage is full")
+
+	// The rematch can be asked for again
+	game, err = gm.getGame(game.GetID())
+	require.NoError(t, err)
+	assert.Empty(t, game.RematchID())
+	assert.Equal(t, "Rematch", gm.gameToPost(game).Attachments()[0].Actions[0].Name)
+}
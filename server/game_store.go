@@ -0,0 +1,375 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/larkox/mattermost-plugin-connect4/server/connect4"
+	"github.com/mattermost/mattermost-server/v5/plugin"
+)
+
+const (
+	gameKeyPrefix         = "game_"
+	channelGamesKeyPrefix = "channel_games_"
+	userGamesKeyPrefix    = "user_games_"
+	invitationKeyPrefix   = "invitation_"
+	queueKeyPrefix        = "queue_"
+	statsKeyPrefix        = "stats_"
+	ratingKeyPrefix       = "rating_"
+	leaderboardKeyPrefix  = "leaderboard_"
+	headToHeadKeyPrefix   = "h2h_"
+	// pendingInvitationsKey indexes the invitations waiting for an answer
+	pendingInvitationsKey = "pending_invitations"
+)
+
+// GameStore keeps the games, along with indexes of the active games of each
+// channel and user. Games are added to the indexes when saved unfinished,
+// and removed from them once they finish.
+type GameStore interface {
+	// Get returns nil when there is no game with the ID.
+	Get(id string) (connect4.Game, error)
+	// Save stores the game, overwriting any previous version of it. Once the
+	// game is stored, failing to update the indexes is logged, not returned.
+	Save(game connect4.Game) error
+	// CompareAndSet stores the game only if the stored version is still old,
+	// or there is no stored version when old is nil. It returns false when
+	// someone else changed the game in the meantime. Like Save, it does not
+	// return errors updating the indexes once the game is stored.
+	CompareAndSet(old, game connect4.Game) (bool, error)
+	Delete(id string) error
+	// ListByUser returns the active games of the user, oldest first.
+	ListByUser(userID string) ([]connect4.Game, error)
+	// ListByChannel returns the active games of the channel, oldest first.
+	ListByChannel(channelID string) ([]connect4.Game, error)
+
+	// GetInvitation returns nil when there is no invitation with the ID.
+	GetInvitation(id string) (*Invitation, error)
+	// CompareAndSetInvitation works like CompareAndSet, for invitations.
+	CompareAndSetInvitation(old, invitation *Invitation) (bool, error)
+	// ListPendingInvitations returns the invitations waiting for an answer.
+	ListPendingInvitations() ([]*Invitation, error)
+
+	// GetRecord returns the record stored with the key, or nil if there is
+	// none. Records are the JSON values kept along with the games, like the
+	// stats of each user or the queue of each team.
+	GetRecord(key string) ([]byte, error)
+	// CompareAndSetRecord stores the record only if the stored value is
+	// still old, or there is no stored value when old is nil. It returns
+	// false when someone else changed the record in the meantime.
+	CompareAndSetRecord(key string, old, value []byte) (bool, error)
+}
+
+type kvGameStore struct {
+	api plugin.API
+}
+
+// NewKVGameStore returns a GameStore backed by the plugin KV store.
+func NewKVGameStore(api plugin.API) GameStore {
+	return &kvGameStore{api: api}
+}
+
+func (s *kvGameStore) Get(id string) (connect4.Game, error) {
+	b, appErr := s.api.KVGet(gameKeyPrefix + id)
+	if appErr != nil {
+		return nil, appErr
+	}
+	if b != nil {
+		return connect4.GameFromJSON(b)
+	}
+
+	// Games created before they had their own ID are stored by channel
+	b, appErr = s.api.KVGet(id)
+	if appErr != nil {
+		return nil, appErr
+	}
+	if b == nil {
+		return nil, nil
+	}
+
+	game, err := connect4.GameFromJSON(b)
+	if err != nil {
+		return nil, err
+	}
+
+	// Move it to its new key, so it can be compared with later versions
+	ok, err := s.CompareAndSet(nil, game)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return s.Get(id)
+	}
+	return game, nil
+}
+
+func (s *kvGameStore) Save(game connect4.Game) error {
+	appErr := s.api.KVSet(gameKeyPrefix+game.GetID(), game.ToJSON())
+	if appErr != nil {
+		return appErr
+	}
+
+	s.indexGame(game)
+	return nil
+}
+
+func (s *kvGameStore) CompareAndSet(old, game connect4.Game) (bool, error) {
+	key := gameKeyPrefix + game.GetID()
+	current, appErr := s.api.KVGet(key)
+	if appErr != nil {
+		return false, appErr
+	}
+
+	// Compare the games as the current version of the plugin stores them,
+	// since games stored by previous versions may lack some fields
+	if (current == nil) != (old == nil) {
+		return false, nil
+	}
+	if current != nil {
+		currentGame, err := connect4.GameFromJSON(current)
+		if err != nil {
+			return false, err
+		}
+		if !bytes.Equal(currentGame.ToJSON(), old.ToJSON()) {
+			return false, nil
+		}
+	}
+
+	ok, appErr := s.api.KVCompareAndSet(key, current, game.ToJSON())
+	if appErr != nil {
+		return false, appErr
+	}
+	if !ok {
+		return false, nil
+	}
+
+	s.indexGame(game)
+	return true, nil
+}
+
+func (s *kvGameStore) Delete(id string) error {
+	game, err := s.Get(id)
+	if err != nil {
+		return err
+	}
+	if game == nil {
+		return nil
+	}
+
+	appErr := s.api.KVDelete(gameKeyPrefix + id)
+	if appErr != nil {
+		return appErr
+	}
+
+	return s.removeFromIndexes(game)
+}
+
+func (s *kvGameStore) ListByUser(userID string) ([]connect4.Game, error) {
+	return s.list(userGamesKeyPrefix + userID)
+}
+
+func (s *kvGameStore) ListByChannel(channelID string) ([]connect4.Game, error) {
+	return s.list(channelGamesKeyPrefix + channelID)
+}
+
+func (s *kvGameStore) list(key string) ([]connect4.Game, error) {
+	b, appErr := s.api.KVGet(key)
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	ids := []string{}
+	if b != nil {
+		err := json.Unmarshal(b, &ids)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	games := []connect4.Game{}
+	for _, id := range ids {
+		game, err := s.Get(id)
+		if err != nil {
+			return nil, err
+		}
+		if game != nil {
+			games = append(games, game)
+		}
+	}
+	return games, nil
+}
+
+func (s *kvGameStore) GetInvitation(id string) (*Invitation, error) {
+	b, appErr := s.api.KVGet(invitationKeyPrefix + id)
+	if appErr != nil {
+		return nil, appErr
+	}
+	if b == nil {
+		return nil, nil
+	}
+
+	return InvitationFromJSON(b)
+}
+
+func (s *kvGameStore) CompareAndSetInvitation(old, invitation *Invitation) (bool, error) {
+	var oldValue []byte
+	if old != nil {
+		oldValue = old.ToJSON()
+	}
+
+	ok, appErr := s.api.KVCompareAndSet(invitationKeyPrefix+invitation.ID, oldValue, invitation.ToJSON())
+	if appErr != nil {
+		return false, appErr
+	}
+	if !ok {
+		return false, nil
+	}
+
+	return true, s.updateIndex(pendingInvitationsKey, func(ids []string) []string {
+		for i, id := range ids {
+			if id == invitation.ID {
+				if invitation.Status != InvitationPending {
+					return append(ids[:i], ids[i+1:]...)
+				}
+				return ids
+			}
+		}
+		if invitation.Status == InvitationPending {
+			return append(ids, invitation.ID)
+		}
+		return ids
+	})
+}
+
+func (s *kvGameStore) ListPendingInvitations() ([]*Invitation, error) {
+	b, appErr := s.api.KVGet(pendingInvitationsKey)
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	ids := []string{}
+	if b != nil {
+		err := json.Unmarshal(b, &ids)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	invitations := []*Invitation{}
+	for _, id := range ids {
+		invitation, err := s.GetInvitation(id)
+		if err != nil {
+			return nil, err
+		}
+		if invitation != nil && invitation.Status == InvitationPending {
+			invitations = append(invitations, invitation)
+		}
+	}
+	return invitations, nil
+}
+
+func (s *kvGameStore) GetRecord(key string) ([]byte, error) {
+	b, appErr := s.api.KVGet(key)
+	if appErr != nil {
+		return nil, appErr
+	}
+	return b, nil
+}
+
+func (s *kvGameStore) CompareAndSetRecord(key string, old, value []byte) (bool, error) {
+	ok, appErr := s.api.KVCompareAndSet(key, old, value)
+	if appErr != nil {
+		return false, appErr
+	}
+	return ok, nil
+}
+
+// indexGame updates the indexes of a game that is already stored. The
+// change to the game cannot be undone at this point, so errors are logged
+// instead of returned.
+func (s *kvGameStore) indexGame(game connect4.Game) {
+	err := s.updateIndexes(game)
+	if err != nil {
+		s.api.LogError("could not update the indexes of the game", "game", game.GetID(), "error", err.Error())
+	}
+}
+
+// updateIndexes lists the game among the active games of its channel and
+// players while it is being played.
+func (s *kvGameStore) updateIndexes(game connect4.Game) error {
+	if game.Outcome() != connect4.OutcomeNoOutcome {
+		return s.removeFromIndexes(game)
+	}
+
+	channelID, _, player1, player2 := game.GetMetadata()
+	for _, key := range []string{channelGamesKeyPrefix + channelID, userGamesKeyPrefix + player1, userGamesKeyPrefix + player2} {
+		err := s.updateIndex(key, func(ids []string) []string {
+			for _, id := range ids {
+				if id == game.GetID() {
+					return ids
+				}
+			}
+			return append(ids, game.GetID())
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *kvGameStore) removeFromIndexes(game connect4.Game) error {
+	channelID, _, player1, player2 := game.GetMetadata()
+	for _, key := range []string{channelGamesKeyPrefix + channelID, userGamesKeyPrefix + player1, userGamesKeyPrefix + player2} {
+		err := s.updateIndex(key, func(ids []string) []string {
+			for i, id := range ids {
+				if id == game.GetID() {
+					return append(ids[:i], ids[i+1:]...)
+				}
+			}
+			return ids
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// updateIndex stores the result of the update of the index, unless the
+// index has changed since it was read. In that case, the update is retried
+// with the new index.
+func (s *kvGameStore) updateIndex(key string, update func(ids []string) []string) error {
+	return retryUpdate(func() (bool, error) {
+		old, appErr := s.api.KVGet(key)
+		if appErr != nil {
+			return false, appErr
+		}
+
+		ids := []string{}
+		if old != nil {
+			err := json.Unmarshal(old, &ids)
+			if err != nil {
+				return false, err
+			}
+		}
+
+		updated := update(ids)
+		if old == nil && len(updated) == 0 {
+			return true, nil
+		}
+
+		value, err := json.Marshal(updated)
+		if err != nil {
+			return false, err
+		}
+		if bytes.Equal(old, value) {
+			return true, nil
+		}
+
+		ok, appErr := s.api.KVCompareAndSet(key, old, value)
+		if appErr != nil {
+			return false, appErr
+		}
+		return ok, nil
+	})
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/larkox/mattermost-plugin-connect4/server/connect4"
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func gameIDs(games []connect4.Game) []string {
+	ids := []string{}
+	for _, game := range games {
+		ids = append(ids, game.GetID())
+	}
+	return ids
+}
+
+func TestGameStore(t *testing.T) {
+	for name, store := range testStores() {
+		t.Run(name, func(t *testing.T) {
+			game, err := store.Get("missing")
+			require.NoError(t, err)
+			assert.Nil(t, game)
+
+			first := connect4.NewGame(model.NewId(), "player1", "player2", "channel", connect4.DefaultOptions())
+			second := connect4.NewGame(model.NewId(), "player1", "player3", "other", connect4.DefaultOptions())
+			ok, err := store.CompareAndSet(nil, first)
+			require.NoError(t, err)
+			assert.True(t, ok)
+			require.NoError(t, store.Save(second))
+
+			// Only creates the game if it does not exist
+			ok, err = store.CompareAndSet(nil, first)
+			require.NoError(t, err)
+			assert.False(t, ok)
+
+			games, err := store.ListByUser("player1")
+			require.NoError(t, err)
+			assert.Equal(t, []string{first.GetID(), second.GetID()}, gameIDs(games))
+			games, err = store.ListByChannel("other")
+			require.NoError(t, err)
+			assert.Equal(t, []string{second.GetID()}, gameIDs(games))
+
+			old, err := store.Get(first.GetID())
+			require.NoError(t, err)
+			require.NoError(t, first.Move(first.ValidMovements()[0]))
+			ok, err = store.CompareAndSet(old, first)
+			require.NoError(t, err)
+			assert.True(t, ok)
+
+			// old is not the stored version anymore
+			require.NoError(t, old.Resign(connect4.Player1))
+			ok, err = store.CompareAndSet(old, old)
+			require.NoError(t, err)
+			assert.False(t, ok)
+
+			stored, err := store.Get(first.GetID())
+			require.NoError(t, err)
+			assert.Len(t, stored.History(), 1)
+
+			// Finished games are not listed
+			require.NoError(t, second.Resign(connect4.Player2))
+			require.NoError(t, store.Save(second))
+			games, err = store.ListByUser("player1")
+			require.NoError(t, err)
+			assert.Equal(t, []string{first.GetID()}, gameIDs(games))
+			games, err = store.ListByUser("player3")
+			require.NoError(t, err)
+			assert.Empty(t, games)
+
+			require.NoError(t, store.Delete(first.GetID()))
+			game, err = store.Get(first.GetID())
+			require.NoError(t, err)
+			assert.Nil(t, game)
+			games, err = store.ListByChannel("channel")
+			require.NoError(t, err)
+			assert.Empty(t, games)
+		})
+	}
+}
+
+func TestKVGameStoreLegacyGames(t *testing.T) {
+	api := newTestAPI()
+	store := NewKVGameStore(api)
+	game := connect4.NewGame("", "player1", "player2", "channel", connect4.DefaultOptions())
+	require.Nil(t, api.KVSet("channel", game.ToJSON()))
+
+	stored, err := store.Get("channel")
+	require.NoError(t, err)
+	require.NotNil(t, stored)
+	assert.Equal(t, "channel", stored.GetID())
+
+	// The game can be updated on its new key
+	require.NoError(t, stored.Move(stored.ValidMovements()[0]))
+	ok, err := store.CompareAndSet(game, stored)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	migrated, err := store.Get("channel")
+	require.NoError(t, err)
+	ok, err = store.CompareAndSet(migrated, stored)
+	require.NoError(t, err)
+	assert.True(t, ok)
+}
+
+func TestGameStoreRecords(t *testing.T) {
+	for name, store := range testStores() {
+		t.Run(name, func(t *testing.T) {
+			record, err := store.GetRecord("stats_player1")
+			require.NoError(t, err)
+			assert.Nil(t, record)
+
+			ok, err := store.CompareAndSetRecord("stats_player1", nil, []byte(`{"Wins":1}`))
+			require.NoError(t, err)
+			assert.True(t, ok)
+
+			ok, err = store.CompareAndSetRecord("stats_player1", nil, []byte(`{"Wins":2}`))
+			require.NoError(t, err)
+			assert.False(t, ok)
+
+			ok, err = store.CompareAndSetRecord("stats_player1", []byte(`{"Wins":3}`), []byte(`{"Wins":4}`))
+			require.NoError(t, err)
+			assert.False(t, ok)
+
+			ok, err = store.CompareAndSetRecord("stats_player1", []byte(`{"Wins":1}`), []byte(`{"Wins":2}`))
+			require.NoError(t, err)
+			assert.True(t, ok)
+
+			record, err = store.GetRecord("stats_player1")
+			require.NoError(t, err)
+			assert.Equal(t, `{"Wins":2}`, string(record))
+		})
+	}
+}
+
+func TestKVGameStoreOlderGames(t *testing.T) {
+	api := newTestAPI()
+	store := NewKVGameStore(api)
+	game := connect4.NewGame(model.NewId(), "player1", "player2", "channel", connect4.DefaultOptions())
+
+	// Stored by a version of the plugin without some of the current fields
+	b := bytes.Replace(game.ToJSON(), []byte(`,"FirstPlayer":`), []byte(`,"Unknown":`), 1)
+	require.Nil(t, api.KVSet(gameKeyPrefix+game.GetID(), b))
+
+	stored, err := store.Get(game.GetID())
+	require.NoError(t, err)
+	updated, err := store.Get(game.GetID())
+	require.NoError(t, err)
+	require.NoError(t, updated.Resign(connect4.Player1))
+
+	ok, err := store.CompareAndSet(stored, updated)
+	require.NoError(t, err)
+	assert.True(t, ok)
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"strings"
+
+	"github.com/larkox/mattermost-plugin-connect4/server/connect4"
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+// HeadToHeadLastResults is the number of recent results kept for each pair of players
+const HeadToHeadLastResults = 5
+
+// HeadToHead is the record of the finished games between two players.
+type HeadToHead struct {
+	// UserIDs are the IDs of both players, sorted
+	UserIDs [2]string
+	// Wins are the wins of each player, in the order of UserIDs
+	Wins  [2]int
+	Draws int
+	// LastResults has the winner of the last games, oldest first. Draws
+	// are stored as an empty string.
+	LastResults         []string
+	CurrentStreak       int
+	CurrentStreakUserID string
+	LongestStreak       int
+	LongestStreakUserID string
+}
+
+func newHeadToHead(userID1, userID2 string) *HeadToHead {
+	if userID2 < userID1 {
+		userID1, userID2 = userID2, userID1
+	}
+	return &HeadToHead{UserIDs: [2]string{userID1, userID2}}
+}
+
+// headToHeadKey returns the key of the record between both users. Both IDs
+// do not fit in a key, so they are hashed.
+func headToHeadKey(userID1, userID2 string) string {
+	h := newHeadToHead(userID1, userID2)
+	sum := sha256.Sum256([]byte(h.UserIDs[0] + h.UserIDs[1]))
+	return headToHeadKeyPrefix + fmt.Sprintf("%x", sum[:16])
+}
+
+func (h *HeadToHead) Games() int {
+	return h.Wins[0] + h.Wins[1] + h.Draws
+}
+
+// Record returns the wins, losses and draws of the user against the other player.
+func (h *HeadToHead) Record(userID string) (wins, losses, draws int) {
+	if userID == h.UserIDs[0] {
+		return h.Wins[0], h.Wins[1], h.Draws
+	}
+	return h.Wins[1], h.Wins[0], h.Draws
+}
+
+// add records a finished game won by the user, or a draw if winnerID is empty.
+func (h *HeadToHead) add(winnerID string) {
+	switch winnerID {
+	case h.UserIDs[0]:
+		h.Wins[0]++
+	case h.UserIDs[1]:
+		h.Wins[1]++
+	default:
+		h.Draws++
+	}
+
+	h.LastResults = append(h.LastResults, winnerID)
+	if len(h.LastResults) > HeadToHeadLastResults {
+		h.LastResults = h.LastResults[len(h.LastResults)-HeadToHeadLastResults:]
+	}
+
+	switch {
+	case winnerID == "":
+		h.CurrentStreak = 0
+		h.CurrentStreakUserID = ""
+	case winnerID == h.CurrentStreakUserID:
+		h.CurrentStreak++
+	default:
+		h.CurrentStreak = 1
+		h.CurrentStreakUserID = winnerID
+	}
+	if h.CurrentStreak > h.LongestStreak {
+		h.LongestStreak = h.CurrentStreak
+		h.LongestStreakUserID = h.CurrentStreakUserID
+	}
+}
+
+func (gm *GameManager) GetHeadToHead(userID1, userID2 string) (*HeadToHead, error) {
+	h := newHeadToHead(userID1, userID2)
+	_, err := gm.getRecord(headToHeadKey(userID1, userID2), h)
+	if err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// headToHeadSummary returns a line with the record between both users, like
+// "Head to head: @user1 3 - 1 @user2, 2 draws".
+func headToHeadSummary(h *HeadToHead, user1, user2 *model.User) string {
+	wins, losses, draws := h.Record(user1.Id)
+	summary := fmt.Sprintf("Head to head: @%s %d - %d @%s", user1.Username, wins, losses, user2.Username)
+	switch draws {
+	case 0:
+	case 1:
+		summary += ", 1 draw"
+	default:
+		summary += fmt.Sprintf(", %d draws", draws)
+	}
+	return summary
+}
+
+// headToHeadDescription returns the record of the players of the new game,
+// or an empty string if they have not met before or one of them is the bot.
+func (gm *GameManager) headToHeadDescription(game connect4.Game) string {
+	if game.GetOptions().BotLevel != connect4.BotLevelNone {
+		return ""
+	}
+
+	_, _, player1, player2 := game.GetMetadata()
+	h, err := gm.GetHeadToHead(player1, player2)
+	if err != nil {
+		gm.api.LogError("could not get the head to head record", "error", err.Error())
+		return ""
+	}
+	if h.Games() == 0 {
+		return ""
+	}
+
+	user1, appErr := gm.api.GetUser(player1)
+	if appErr != nil {
+		return ""
+	}
+	user2, appErr := gm.api.GetUser(player2)
+	if appErr != nil {
+		return ""
+	}
+	return headToHeadSummary(h, user1, user2)
+}
+
+// lastResults returns the last results of the user against the other player,
+// like "W L D", oldest first.
+func lastResults(h *HeadToHead, userID string) string {
+	results := []string{}
+	for _, winnerID := range h.LastResults {
+		switch winnerID {
+		case userID:
+			results = append(results, "W")
+		case "":
+			results = append(results, "D")
+		default:
+			results = append(results, "L")
+		}
+	}
+	return strings.Join(results, " ")
+}
+
+// updateHeadToHead adds the finished game to the record of both players.
+// Games against the bot are not recorded.
+func (gm *GameManager) updateHeadToHead(game connect4.Game) error {
+	if game.GetOptions().BotLevel != connect4.BotLevelNone {
+		return nil
+	}
+
+	_, _, player1, player2 := game.GetMetadata()
+	winnerID := ""
+	switch winner(game.Outcome()) {
+	case connect4.Player1:
+		winnerID = player1
+	case connect4.Player2:
+		winnerID = player2
+	}
+
+	return gm.updateRecord(headToHeadKey(player1, player2), func() interface{} { return newHeadToHead(player1, player2) }, func(record interface{}) error {
+		record.(*HeadToHead).add(winnerID)
+		return nil
+	})
+}
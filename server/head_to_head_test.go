@@ -0,0 +1,73 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/larkox/mattermost-plugin-connect4/server/connect4"
+	"github.com/mattermost/mattermost-server/v5/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHeadToHeadAdd(t *testing.T) {
+	h := newHeadToHead("b", "a")
+	assert.Equal(t, [2]string{"a", "b"}, h.UserIDs)
+
+	for _, winnerID := range []string{"a", "b", "b", "b", "", "a", "a"} {
+		h.add(winnerID)
+	}
+
+	wins, losses, draws := h.Record("b")
+	assert.Equal(t, []int{3, 3, 1}, []int{wins, losses, draws})
+	assert.Equal(t, 7, h.Games())
+	assert.Equal(t, []string{"b", "b", "", "a", "a"}, h.LastResults)
+	assert.Equal(t, "W W D L L", lastResults(h, "b"))
+	assert.Equal(t, 2, h.CurrentStreak)
+	assert.Equal(t, "a", h.CurrentStreakUserID)
+	assert.Equal(t, 3, h.LongestStreak)
+	assert.Equal(t, "b", h.LongestStreakUserID)
+
+	summary := headToHeadSummary(h, &model.User{Id: "a", Username: "alice"}, &model.User{Id: "b", Username: "bob"})
+	assert.Equal(t, "Head to head: @alice 3 - 3 @bob, 1 draw", summary)
+}
+
+func TestHeadToHead(t *testing.T) {
+	for name, store := range testStores() {
+		t.Run(name, func(t *testing.T) {
+			gm := newTestGameManager(store)
+
+			game := playGame(t, gm, "player1", "player2")
+			assert.NotContains(t, gm.gameToPost(game).Attachments()[0].Text, "Head to head")
+
+			_, err := gm.Resign(game.GetID(), "player2")
+			require.NoError(t, err)
+			playGame(t, gm, "player2", "player1", 1, 2, 1, 2, 1, 2, 1)
+
+			h, err := gm.GetHeadToHead("player2", "player1")
+			require.NoError(t, err)
+			wins, losses, draws := h.Record("player1")
+			assert.Equal(t, []int{1, 1, 0}, []int{wins, losses, draws})
+
+			// New games between the same players show the record when they start
+			game = playGame(t, gm, "player1", "player2")
+			assert.Contains(t, gm.gameToPost(game).Attachments()[0].Text, "\nHead to head: @player1 1 - 1 @player2")
+			_, err = gm.Resign(game.GetID(), "player2")
+			require.NoError(t, err)
+			game, err = gm.getGame(game.GetID())
+			require.NoError(t, err)
+			assert.Contains(t, gm.gameToPost(game).Attachments()[0].Text, "\nHead to head: @player1 1 - 1 @player2")
+
+			// Games against the bot are not recorded
+			options := connect4.DefaultOptions()
+			options.BotLevel = connect4.BotLevelEasy
+			game, err = gm.CreateGame("player1", "bot", "channel", options)
+			require.NoError(t, err)
+			_, err = gm.Resign(game.GetID(), "player1")
+			require.NoError(t, err)
+
+			h, err = gm.GetHeadToHead("player1", "bot")
+			require.NoError(t, err)
+			assert.Equal(t, 0, h.Games())
+		})
+	}
+}
@@ -0,0 +1,413 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/larkox/mattermost-plugin-connect4/server/connect4"
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+const (
+	InvitationPending  = "pending"
+	InvitationAccepted = "accepted"
+	InvitationDeclined = "declined"
+	InvitationExpired  = "expired"
+
+	// InvitationExpiryInterval is how often unanswered invitations are expired
+	InvitationExpiryInterval = time.Minute
+	invitationExpiryFormat   = "Jan 2 at 15:04 MST"
+)
+
+// Invitation is a challenge waiting for the opponent to accept it. The game
+// is only created once the invitation is accepted.
+type Invitation struct {
+	ID           string
+	ChallengerID string
+	// OpponentID is empty on open challenges until someone joins them
+	OpponentID string
+	// ChannelID is the channel where the invitation is posted, and where the game will be played
+	ChannelID string
+	PostID    string
+	Options   connect4.Options
+	ExpiresAt time.Time
+	Status    string
+}
+
+func (i *Invitation) ToJSON() []byte {
+	b, _ := json.Marshal(i)
+	return b
+}
+
+func InvitationFromJSON(b []byte) (*Invitation, error) {
+	i := &Invitation{}
+	err := json.Unmarshal(b, i)
+	if err != nil {
+		return nil, err
+	}
+	return i, nil
+}
+
+// Invite posts a challenge for the opponent to accept or decline. The
+// invitation expires if it is not answered in time.
+func (gm *GameManager) Invite(challengerID, opponentID, channelID string, options connect4.Options, expiry time.Duration) (*Invitation, error) {
+	err := options.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	if options.BotLevel != connect4.BotLevelNone {
+		return nil, errors.New("only games against the bot have a bot level")
+	}
+
+	channelID, err = gm.gameChannel(channelID, challengerID, opponentID)
+	if err != nil {
+		return nil, err
+	}
+
+	return gm.createInvitation(&Invitation{
+		ID:           model.NewId(),
+		ChallengerID: challengerID,
+		OpponentID:   opponentID,
+		ChannelID:    channelID,
+		Options:      options,
+		ExpiresAt:    time.Now().Add(expiry),
+		Status:       InvitationPending,
+	})
+}
+
+// OpenChallenge posts a challenge that any other member of the channel can
+// join. It expires if nobody joins it in time.
+func (gm *GameManager) OpenChallenge(challengerID, channelID string, options connect4.Options, expiry time.Duration) (*Invitation, error) {
+	err := options.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	if options.BotLevel != connect4.BotLevelNone {
+		return nil, errors.New("only games against the bot have a bot level")
+	}
+
+	return gm.createInvitation(&Invitation{
+		ID:           model.NewId(),
+		ChallengerID: challengerID,
+		ChannelID:    channelID,
+		Options:      options,
+		ExpiresAt:    time.Now().Add(expiry),
+		Status:       InvitationPending,
+	})
+}
+
+func (gm *GameManager) createInvitation(invitation *Invitation) (*Invitation, error) {
+	post, appErr := gm.api.CreatePost(gm.invitationToPost(invitation))
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	invitation.PostID = post.Id
+	ok, err := gm.store.CompareAndSetInvitation(nil, invitation)
+	if err == nil && !ok {
+		err = errors.New("the challenge already exists")
+	}
+	if err != nil {
+		// Nobody can answer the post without the invitation
+		_ = gm.api.DeletePost(post.Id)
+		return nil, err
+	}
+	return invitation, nil
+}
+
+// AcceptInvitation creates the game of the invitation. On open challenges,
+// the user becomes the opponent.
+func (gm *GameManager) AcceptInvitation(id, userID string) (connect4.Game, error) {
+	invitation, pending, err := gm.answerInvitation(id, userID, InvitationAccepted)
+	if err != nil {
+		return nil, err
+	}
+
+	game, err := gm.CreateGame(invitation.ChallengerID, invitation.OpponentID, invitation.ChannelID, invitation.Options)
+	if err != nil {
+		gm.reopenInvitation(invitation, pending)
+		return nil, err
+	}
+
+	gm.events.publish(GameEvent{Type: ChallengeAccepted, Game: game, UserID: userID, Invitation: invitation})
+	return game, nil
+}
+
+func (gm *GameManager) DeclineInvitation(id, userID string) error {
+	invitation, _, err := gm.answerInvitation(id, userID, InvitationDeclined)
+	if err != nil {
+		return err
+	}
+
+	gm.events.publish(GameEvent{Type: ChallengeDeclined, UserID: userID, Invitation: invitation})
+	return nil
+}
+
+// answerInvitation stores the answer of the opponent and updates the
+// invitation post. Invitations answered too late expire instead. It returns
+// the answered invitation and the pending one it replaced.
+func (gm *GameManager) answerInvitation(id, userID, status string) (*Invitation, *Invitation, error) {
+	var answered, previous *Invitation
+	err := retryUpdate(func() (bool, error) {
+		old, err := gm.store.GetInvitation(id)
+		if err != nil {
+			return false, err
+		}
+		if old == nil {
+			return false, errors.New("challenge not found")
+		}
+
+		if old.Status != InvitationPending {
+			return false, fmt.Errorf("the challenge was already %s", old.Status)
+		}
+
+		invitation := *old
+		if old.OpponentID == "" {
+			err = gm.checkCanJoin(old, userID, status)
+			if err != nil {
+				return false, err
+			}
+			invitation.OpponentID = userID
+		} else if old.OpponentID != userID {
+			return false, errors.New("the challenge is not for you")
+		}
+
+		invitation.Status = status
+		if time.Now().After(invitation.ExpiresAt) {
+			invitation.Status = InvitationExpired
+			invitation.OpponentID = old.OpponentID
+		}
+
+		ok, err := gm.store.CompareAndSetInvitation(old, &invitation)
+		if err != nil || !ok {
+			return false, err
+		}
+
+		_, _ = gm.api.UpdatePost(gm.invitationToPost(&invitation))
+		if invitation.Status == InvitationExpired {
+			gm.events.publish(GameEvent{Type: ChallengeExpired, Invitation: &invitation})
+			return false, errors.New("the challenge has expired")
+		}
+
+		answered, previous = &invitation, old
+		return true, nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return answered, previous, nil
+}
+
+// ExpireInvitations expires the pending invitations that were not answered
+// in time. It runs periodically, so the challengers learn about it even if
+// nobody tries to answer them. An invitation that cannot be expired is
+// logged and retried on the next run, without stopping the others.
+func (gm *GameManager) ExpireInvitations() error {
+	invitations, err := gm.store.ListPendingInvitations()
+	if err != nil {
+		return err
+	}
+
+	for _, invitation := range invitations {
+		if time.Now().Before(invitation.ExpiresAt) {
+			continue
+		}
+
+		err = gm.expireInvitation(invitation.ID)
+		if err != nil {
+			gm.api.LogError("could not expire the invitation", "invitation", invitation.ID, "error", err.Error())
+		}
+	}
+	return nil
+}
+
+func (gm *GameManager) expireInvitation(id string) error {
+	return retryUpdate(func() (bool, error) {
+		old, err := gm.store.GetInvitation(id)
+		if err != nil {
+			return false, err
+		}
+		if old == nil || old.Status != InvitationPending {
+			return true, nil
+		}
+
+		invitation := *old
+		invitation.Status = InvitationExpired
+		ok, err := gm.store.CompareAndSetInvitation(old, &invitation)
+		if err != nil || !ok {
+			return false, err
+		}
+
+		_, _ = gm.api.UpdatePost(gm.invitationToPost(&invitation))
+		gm.events.publish(GameEvent{Type: ChallengeExpired, Invitation: &invitation})
+		return true, nil
+	})
+}
+
+// notifyChallenge tells the challenger what happened to the challenge.
+func (gm *GameManager) notifyChallenge(event GameEvent) {
+	switch event.Type {
+	case ChallengeAccepted:
+		gm.notifyChallenger(event.Invitation, "%s accepted your challenge.")
+	case ChallengeDeclined:
+		gm.notifyChallenger(event.Invitation, "%s declined your challenge.")
+	case ChallengeExpired:
+		gm.notifyExpired(event.Invitation)
+	}
+}
+
+// notifyExpired tells the challenger the invitation expired.
+func (gm *GameManager) notifyExpired(invitation *Invitation) {
+	if invitation.OpponentID == "" {
+		gm.api.SendEphemeralPost(invitation.ChallengerID, &model.Post{
+			ChannelId: invitation.ChannelID,
+			UserId:    gm.botID,
+			Message:   "Your open challenge expired before anyone joined it.",
+		})
+		return
+	}
+
+	gm.notifyChallenger(invitation, "Your challenge to %s expired before being accepted.")
+}
+
+// reopenInvitation makes the accepted invitation pending again, when its
+// game could not be created, so it can be accepted again.
+func (gm *GameManager) reopenInvitation(accepted, pending *Invitation) {
+	ok, err := gm.store.CompareAndSetInvitation(accepted, pending)
+	if err == nil && !ok {
+		err = errors.New("the challenge has changed")
+	}
+	if err != nil {
+		gm.api.LogError("could not reopen the challenge", "invitation", accepted.ID, "error", err.Error())
+		return
+	}
+
+	_, _ = gm.api.UpdatePost(gm.invitationToPost(pending))
+}
+
+// checkCanJoin returns an error if the user cannot answer the open challenge.
+func (gm *GameManager) checkCanJoin(invitation *Invitation, userID, status string) error {
+	if status != InvitationAccepted {
+		return errors.New("open challenges cannot be declined")
+	}
+
+	if invitation.ChallengerID == userID {
+		return errors.New("you cannot join your own challenge")
+	}
+
+	_, appErr := gm.api.GetChannelMember(invitation.ChannelID, userID)
+	if appErr != nil {
+		return errors.New("only members of the channel can join the challenge")
+	}
+	return nil
+}
+
+func (gm *GameManager) invitationToPost(invitation *Invitation) *model.Post {
+	post := &model.Post{
+		Id:        invitation.PostID,
+		ChannelId: invitation.ChannelID,
+		UserId:    gm.botID,
+	}
+
+	challenger, appErr := gm.api.GetUser(invitation.ChallengerID)
+	if appErr != nil {
+		return post
+	}
+
+	options := invitation.Options
+	attachment := &model.SlackAttachment{
+		Title: "Connect4 challenge",
+		Text: fmt.Sprintf(
+			"@%s is looking for an opponent for a game of Connect%d.\nBoard: %dx%d, %d in a row to win",
+			challenger.Username,
+			options.WinLength,
+			options.Columns,
+			options.Rows,
+			options.WinLength,
+		),
+	}
+	if invitation.OpponentID != "" {
+		opponent, appErr := gm.api.GetUser(invitation.OpponentID)
+		if appErr != nil {
+			return post
+		}
+		attachment.Text = fmt.Sprintf(
+			"@%s challenges @%s to a game of Connect%d.\nBoard: %dx%d, %d in a row to win",
+			challenger.Username,
+			opponent.Username,
+			options.WinLength,
+			options.Columns,
+			options.Rows,
+			options.WinLength,
+		)
+	}
+	if options.PopOut {
+		attachment.Text += "\nPopOut: you may remove your own pieces from the bottom row"
+	}
+	if options.Ranked {
+		attachment.Text += "\nRanked game"
+	}
+
+	switch invitation.Status {
+	case InvitationPending:
+		attachment.Footer = "The challenge expires on " + invitation.ExpiresAt.UTC().Format(invitationExpiryFormat) + "."
+		if invitation.OpponentID == "" {
+			attachment.Actions = []*model.PostAction{
+				{
+					Type: "button",
+					Name: "Join",
+					Integration: &model.PostActionIntegration{
+						URL: gm.getAttachmentURL() + AttachmentPathInvitationAccept + "/" + invitation.ID,
+					},
+				},
+			}
+			break
+		}
+
+		attachment.Actions = []*model.PostAction{
+			{
+				Type: "button",
+				Name: "Accept",
+				Integration: &model.PostActionIntegration{
+					URL: gm.getAttachmentURL() + AttachmentPathInvitationAccept + "/" + invitation.ID,
+				},
+			},
+			{
+				Type: "button",
+				Name: "Decline",
+				Integration: &model.PostActionIntegration{
+					URL: gm.getAttachmentURL() + AttachmentPathInvitationDecline + "/" + invitation.ID,
+				},
+			},
+		}
+	case InvitationAccepted:
+		attachment.Footer = "Challenge accepted!"
+	case InvitationDeclined:
+		attachment.Footer = "Challenge declined."
+	case InvitationExpired:
+		attachment.Footer = "Challenge expired."
+	}
+
+	model.ParseSlackAttachment(post, []*model.SlackAttachment{attachment})
+	return post
+}
+
+// notifyChallenger tells the challenger what happened to the invitation.
+// The text is formatted with the opponent username.
+func (gm *GameManager) notifyChallenger(invitation *Invitation, text string) {
+	opponent, appErr := gm.api.GetUser(invitation.OpponentID)
+	if appErr != nil {
+		return
+	}
+
+	gm.api.SendEphemeralPost(invitation.ChallengerID, &model.Post{
+		ChannelId: invitation.ChannelID,
+		UserId:    gm.botID,
+		Message:   fmt.Sprintf(text, opponent.Username),
+	})
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/larkox/mattermost-plugin-connect4/server/connect4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInvitations(t *testing.T) {
+	t.Run("accept", func(t *testing.T) {
+		api := newTestAPI()
+		store := NewMemoryGameStore()
+		gm := newTestGameManagerWithAPI(api, store)
+
+		invitation, err := gm.Invite("player1", "player2", "channel", connect4.DefaultOptions(), time.Hour)
+		require.NoError(t, err)
+		assert.Equal(t, "channel", invitation.ChannelID)
+
+		games, err := store.ListByUser("player1")
+		require.NoError(t, err)
+		assert.Empty(t, games)
+
+		_, err = gm.AcceptInvitation(invitation.ID, "player1")
+		assert.EqualError(t, err, "the challenge is not for you")
+
+		game, err := gm.AcceptInvitation(invitation.ID, "player2")
+		require.NoError(t, err)
+		_, _, player1, player2 := game.GetMetadata()
+		assert.Equal(t, "player1", player1)
+		assert.Equal(t, "player2", player2)
+		assert.Equal(t, []string{"player2 accepted your challenge."}, api.ephemeralPosts["player1"])
+
+		_, err = gm.AcceptInvitation(invitation.ID, "player2")
+		assert.EqualError(t, err, "the challenge was already accepted")
+		assert.EqualError(t, gm.DeclineInvitation(invitation.ID, "player2"), "the challenge was already accepted")
+
+		games, err = store.ListByUser("player1")
+		require.NoError(t, err)
+		assert.Len(t, games, 1)
+	})
+
+	t.Run("decline", func(t *testing.T) {
+		api := newTestAPI()
+		store := NewMemoryGameStore()
+		gm := newTestGameManagerWithAPI(api, store)
+
+		invitation, err := gm.Invite("player1", "player2", "channel", connect4.DefaultOptions(), time.Hour)
+		require.NoError(t, err)
+
+		require.NoError(t, gm.DeclineInvitation(invitation.ID, "player2"))
+		assert.Equal(t, []string{"player2 declined your challenge."}, api.ephemeralPosts["player1"])
+
+		_, err = gm.AcceptInvitation(invitation.ID, "player2")
+		assert.EqualError(t, err, "the challenge was already declined")
+
+		games, err := store.ListByUser("player1")
+		require.NoError(t, err)
+		assert.Empty(t, games)
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		api := newTestAPI()
+		store := NewMemoryGameStore()
+		gm := newTestGameManagerWithAPI(api, store)
+
+		invitation, err := gm.Invite("player1", "player2", "channel", connect4.DefaultOptions(), -time.Minute)
+		require.NoError(t, err)
+
+		_, err = gm.AcceptInvitation(invitation.ID, "player2")
+		assert.EqualError(t, err, "the challenge has expired")
+		assert.Equal(t, []string{"Your challenge to player2 expired before being accepted."}, api.ephemeralPosts["player1"])
+
+		stored, err := store.GetInvitation(invitation.ID)
+		require.NoError(t, err)
+		assert.Equal(t, InvitationExpired, stored.Status)
+
+		games, err := store.ListByUser("player1")
+		require.NoError(t, err)
+		assert.Empty(t, games)
+	})
+
+	t.Run("scheduled expiry", func(t *testing.T) {
+		for name, store := range testStores() {
+			t.Run(name, func(t *testing.T) {
+				api := newTestAPI()
+				gm := newTestGameManagerWithAPI(api, store)
+
+				expired, err := gm.Invite("player1", "player2", "channel", connect4.DefaultOptions(), -time.Minute)
+				require.NoError(t, err)
+				open, err := gm.OpenChallenge("player1", "channel", connect4.DefaultOptions(), -time.Minute)
+				require.NoError(t, err)
+				pending, err := gm.Invite("player1", "player3", "channel", connect4.DefaultOptions(), time.Hour)
+				require.NoError(t, err)
+
+				require.NoError(t, gm.ExpireInvitations())
+				assert.ElementsMatch(t, []string{
+					"Your challenge to player2 expired before being accepted.",
+					"Your open challenge expired before anyone joined it.",
+				}, api.ephemeralPosts["player1"])
+
+				for _, invitation := range []*Invitation{expired, open} {
+					stored, err := store.GetInvitation(invitation.ID)
+					require.NoError(t, err)
+					assert.Equal(t, InvitationExpired, stored.Status)
+				}
+
+				invitations, err := store.ListPendingInvitations()
+				require.NoError(t, err)
+				require.Len(t, invitations, 1)
+				assert.Equal(t, pending.ID, invitations[0].ID)
+
+				// Expired invitations are not expired again
+				require.NoError(t, gm.ExpireInvitations())
+				assert.Len(t, api.ephemeralPosts["player1"], 2)
+			})
+		}
+	})
+
+	t.Run("expiry failure", func(t *testing.T) {
+		api := newTestAPI()
+		store := &failingInvitationStore{GameStore: NewMemoryGameStore()}
+		gm := newTestGameManagerWithAPI(api, store)
+
+		failing, err := gm.Invite("player1", "player2", "channel", connect4.DefaultOptions(), -time.Minute)
+		require.NoError(t, err)
+		expired, err := gm.Invite("player1", "player3", "channel", connect4.DefaultOptions(), -time.Minute)
+		require.NoError(t, err)
+		store.failingID = failing.ID
+
+		// The failing invitation does not stop the others from expiring
+		require.NoError(t, gm.ExpireInvitations())
+		assert.Equal(t, []string{"Your challenge to player3 expired before being accepted."}, api.ephemeralPosts["player1"])
+		stored, err := store.GetInvitation(expired.ID)
+		require.NoError(t, err)
+		assert.Equal(t, InvitationExpired, stored.Status)
+
+		// It is expired on the next run
+		store.failingID = ""
+		require.NoError(t, gm.ExpireInvitations())
+		stored, err = store.GetInvitation(failing.ID)
+		require.NoError(t, err)
+		assert.Equal(t, InvitationExpired, stored.Status)
+	})
+
+	t.Run("open challenge", func(t *testing.T) {
+		api := newTestAPI()
+		store := NewMemoryGameStore()
+		gm := newTestGameManagerWithAPI(api, store)
+
+		invitation, err := gm.OpenChallenge("player1", "channel", connect4.DefaultOptions(), time.Hour)
+		require.NoError(t, err)
+
+		_, err = gm.AcceptInvitation(invitation.ID, "player1")
+		assert.EqualError(t, err, "you cannot join your own challenge")
+		assert.EqualError(t, gm.DeclineInvitation(invitation.ID, "player2"), "open challenges cannot be declined")
+
+		game, err := gm.AcceptInvitation(invitation.ID, "player3")
+		require.NoError(t, err)
+		channelID, _, player1, player2 := game.GetMetadata()
+		assert.Equal(t, "channel", channelID)
+		assert.Equal(t, "player1", player1)
+		assert.Equal(t, "player3", player2)
+
+		_, err = gm.AcceptInvitation(invitation.ID, "player2")
+		assert.EqualError(t, err, "the challenge was already accepted")
+	})
+
+	t.Run("game not created", func(t *testing.T) {
+		store := &unsavableStore{NewMemoryGameStore()}
+		gm := newTestGameManager(store)
+
+		invitation, err := gm.OpenChallenge("player1", "channel", connect4.DefaultOptions(), time.Hour)
+		require.NoError(t, err)
+
+		_, err = gm.AcceptInvitation(invitation.ID, "player2")
+		assert.EqualError(t, err, "storage is full")
+
+		// The challenge can still be joined
+		stored, err := store.GetInvitation(invitation.ID)
+		require.NoError(t, err)
+		assert.Equal(t, InvitationPending, stored.Status)
+		assert.Empty(t, stored.OpponentID)
+	})
+
+	t.Run("not stored", func(t *testing.T) {
+		api := newTestAPI()
+		gm := newTestGameManagerWithAPI(api, &conflictingInvitationStore{NewMemoryGameStore()})
+
+		_, err := gm.Invite("player1", "player2", "channel", connect4.DefaultOptions(), time.Hour)
+		assert.EqualError(t, err, "the challenge already exists")
+		assert.Len(t, api.deletedPosts, 1)
+	})
+}
+
+// conflictingInvitationStore never stores invitations, as if they always
+// existed already.
+type conflictingInvitationStore struct {
+	GameStore
+}
+
+func (s *conflictingInvitationStore) CompareAndSetInvitation(old, invitation *Invitation) (bool, error) {
+	return false, nil
+}
+
+// failingInvitationStore fails to update the invitation with failingID.
+type failingInvitationStore struct {
+	GameStore
+	failingID string
+}
+
+func (s *failingInvitationStore) CompareAndSetInvitation(old, invitation *Invitation) (bool, error) {
+	if invitation.ID == s.failingID {
+		return false, errors.New("storage is down")
+	}
+	return s.GameStore.CompareAndSetInvitation(old, invitation)
+}
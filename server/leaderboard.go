@@ -0,0 +1,194 @@
+package main
+
+import (
+	"sort"
+	"time"
+
+	"github.com/larkox/mattermost-plugin-connect4/server/connect4"
+)
+
+const (
+	LeaderboardWins   = "wins"
+	LeaderboardRating = "rating"
+	LeaderboardStreak = "streak"
+
+	// LeaderboardAllTime is the period of the leaderboard that never resets.
+	// Monthly leaderboards use the month as period, like 2021-04.
+	LeaderboardAllTime = "all"
+	leaderboardMonth   = "2006-01"
+
+	// LeaderboardSize is the number of players shown in leaderboards
+	LeaderboardSize = 10
+)
+
+// Leaderboard has the results in a period of the players of a team, by user ID.
+type Leaderboard map[string]LeaderboardEntry
+
+// LeaderboardEntry is the result of a player in a leaderboard period.
+type LeaderboardEntry struct {
+	UserID        string
+	Games         int
+	Wins          int
+	CurrentStreak int
+	BestStreak    int
+	// Rating is the rating after the last ranked game of the period, or 0
+	// if the player has not played ranked games in it.
+	Rating int
+}
+
+func leaderboardKey(teamID, period string) string {
+	return leaderboardKeyPrefix + teamID + "_" + period
+}
+
+// monthPeriod returns the period of the monthly leaderboard of the time.
+func monthPeriod(t time.Time) string {
+	return t.UTC().Format(leaderboardMonth)
+}
+
+// ValidLeaderboardPeriod tells if the period is all time or a month.
+func ValidLeaderboardPeriod(period string) bool {
+	if period == LeaderboardAllTime {
+		return true
+	}
+	_, err := time.Parse(leaderboardMonth, period)
+	return err == nil
+}
+
+// Top returns the best players of the leaderboard by the criteria, which is
+// one of LeaderboardWins, LeaderboardRating or LeaderboardStreak.
+func (l Leaderboard) Top(criteria string, n int) []LeaderboardEntry {
+	value := func(e LeaderboardEntry) int {
+		switch criteria {
+		case LeaderboardRating:
+			return e.Rating
+		case LeaderboardStreak:
+			return e.BestStreak
+		}
+		return e.Wins
+	}
+
+	entries := []LeaderboardEntry{}
+	for _, e := range l {
+		if criteria == LeaderboardRating && e.Rating == 0 {
+			continue
+		}
+		entries = append(entries, e)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if value(entries[i]) != value(entries[j]) {
+			return value(entries[i]) > value(entries[j])
+		}
+		// Fewer games for the same value is better
+		if entries[i].Games != entries[j].Games {
+			return entries[i].Games < entries[j].Games
+		}
+		return entries[i].UserID < entries[j].UserID
+	})
+
+	if len(entries) > n {
+		entries = entries[:n]
+	}
+	return entries
+}
+
+// add records the finished game of the user, played as player.
+func (l Leaderboard) add(userID string, game connect4.Game, player int, rating *Rating) {
+	e := l[userID]
+	e.UserID = userID
+	e.Games++
+	if winner(game.Outcome()) == player {
+		e.Wins++
+		e.CurrentStreak++
+		if e.CurrentStreak > e.BestStreak {
+			e.BestStreak = e.CurrentStreak
+		}
+	} else {
+		e.CurrentStreak = 0
+	}
+
+	if rating != nil {
+		e.Rating = rating.Rating
+	}
+	l[userID] = e
+}
+
+func (gm *GameManager) GetLeaderboard(teamID, period string) (Leaderboard, error) {
+	leaderboard := Leaderboard{}
+	_, err := gm.getRecord(leaderboardKey(teamID, period), &leaderboard)
+	if err != nil {
+		return nil, err
+	}
+	return leaderboard, nil
+}
+
+// updateLeaderboards adds the finished game to the all time and monthly
+// leaderboards of the teams of the game. Games in a team channel count for
+// that team, and games in direct or group channels count for every team
+// both players are members of. Games against the bot are not ranked.
+func (gm *GameManager) updateLeaderboards(game connect4.Game) error {
+	if game.GetOptions().BotLevel != connect4.BotLevelNone {
+		return nil
+	}
+
+	channelID, _, player1, player2 := game.GetMetadata()
+	teamIDs, err := gm.gameTeams(channelID, player1, player2)
+	if err != nil {
+		return err
+	}
+
+	ratings := map[string]*Rating{}
+	if game.GetOptions().Ranked {
+		for _, userID := range []string{player1, player2} {
+			ratings[userID], err = gm.GetRating(userID)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	periods := []string{LeaderboardAllTime, monthPeriod(time.Now())}
+	for _, teamID := range teamIDs {
+		for _, period := range periods {
+			err = gm.updateLeaderboard(teamID, period, func(l Leaderboard) {
+				l.add(player1, game, connect4.Player1, ratings[player1])
+				l.add(player2, game, connect4.Player2, ratings[player2])
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (gm *GameManager) gameTeams(channelID, player1, player2 string) ([]string, error) {
+	c, appErr := gm.api.GetChannel(channelID)
+	if appErr != nil {
+		return nil, appErr
+	}
+	if c.TeamId != "" {
+		return []string{c.TeamId}, nil
+	}
+
+	teams, appErr := gm.api.GetTeamsForUser(player1)
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	teamIDs := []string{}
+	for _, t := range teams {
+		_, appErr = gm.api.GetTeamMember(t.Id, player2)
+		if appErr == nil {
+			teamIDs = append(teamIDs, t.Id)
+		}
+	}
+	return teamIDs, nil
+}
+
+func (gm *GameManager) updateLeaderboard(teamID, period string, update func(l Leaderboard)) error {
+	return gm.updateRecord(leaderboardKey(teamID, period), func() interface{} { return &Leaderboard{} }, func(record interface{}) error {
+		update(*record.(*Leaderboard))
+		return nil
+	})
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/larkox/mattermost-plugin-connect4/server/connect4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLeaderboardTop(t *testing.T) {
+	l := Leaderboard{
+		"a": {UserID: "a", Games: 5, Wins: 3, BestStreak: 1},
+		"b": {UserID: "b", Games: 4, Wins: 3, BestStreak: 3, Rating: 1520},
+		"c": {UserID: "c", Games: 2, Wins: 1, BestStreak: 1, Rating: 1480},
+	}
+
+	ids := func(entries []LeaderboardEntry) []string {
+		result := []string{}
+		for _, e := range entries {
+			result = append(result, e.UserID)
+		}
+		return result
+	}
+
+	// Fewer games wins the ties
+	assert.Equal(t, []string{"b", "a", "c"}, ids(l.Top(LeaderboardWins, LeaderboardSize)))
+	assert.Equal(t, []string{"b", "c", "a"}, ids(l.Top(LeaderboardStreak, LeaderboardSize)))
+	// Players without ranked games have no rating
+	assert.Equal(t, []string{"b", "c"}, ids(l.Top(LeaderboardRating, LeaderboardSize)))
+	assert.Equal(t, []string{"b"}, ids(l.Top(LeaderboardWins, 1)))
+}
+
+func TestValidLeaderboardPeriod(t *testing.T) {
+	assert.True(t, ValidLeaderboardPeriod(LeaderboardAllTime))
+	assert.True(t, ValidLeaderboardPeriod("2021-04"))
+	assert.False(t, ValidLeaderboardPeriod("2021-13"))
+	assert.False(t, ValidLeaderboardPeriod("april"))
+}
+
+func TestLeaderboards(t *testing.T) {
+	gm := newTestGameManager(NewMemoryGameStore())
+
+	playGame(t, gm, "player1", "player2", 1, 2, 1, 2, 1, 2, 1)
+	playGame(t, gm, "player1", "player2", 1, 2, 1, 2, 1, 2, 1)
+	game := playGame(t, gm, "player2", "player1", 3)
+	_, err := gm.Resign(game.GetID(), "player1")
+	require.NoError(t, err)
+
+	// Unfinished games are not in the leaderboards
+	playGame(t, gm, "player1", "player2", 1)
+
+	for _, period := range []string{LeaderboardAllTime, monthPeriod(time.Now())} {
+		l, err := gm.GetLeaderboard("team", period)
+		require.NoError(t, err)
+		assert.Equal(t, Leaderboard{
+			"player1": {UserID: "player1", Games: 3, Wins: 2, BestStreak: 2},
+			"player2": {UserID: "player2", Games: 3, Wins: 1, CurrentStreak: 1, BestStreak: 1},
+		}, l)
+	}
+
+	l, err := gm.GetLeaderboard("other", LeaderboardAllTime)
+	require.NoError(t, err)
+	assert.Empty(t, l)
+
+	options := connect4.DefaultOptions()
+	options.Ranked = true
+	game, err = gm.CreateGame("player1", "player3", "channel", options)
+	require.NoError(t, err)
+	_, err = gm.Resign(game.GetID(), "player3")
+	require.NoError(t, err)
+
+	l, err = gm.GetLeaderboard("team", LeaderboardAllTime)
+	require.NoError(t, err)
+	assert.Equal(t, DefaultRating+20, l["player1"].Rating)
+	assert.Equal(t, DefaultRating-20, l["player3"].Rating)
+	assert.Equal(t, 0, l["player2"].Rating)
+}
+
+func TestLeaderboardTeams(t *testing.T) {
+	gm := newTestGameManager(NewMemoryGameStore())
+
+	// Games in direct messages count for the teams both players are in
+	game, err := gm.CreateGame("player1", "outsider", "", connect4.DefaultOptions())
+	require.NoError(t, err)
+	_, err = gm.Resign(game.GetID(), "player1")
+	require.NoError(t, err)
+
+	l, err := gm.GetLeaderboard("team", LeaderboardAllTime)
+	require.NoError(t, err)
+	assert.Empty(t, l)
+	l, err = gm.GetLeaderboard("other", LeaderboardAllTime)
+	require.NoError(t, err)
+	assert.Equal(t, 1, l["outsider"].Wins)
+
+	// Games against the bot are not in the leaderboards
+	options := connect4.DefaultOptions()
+	options.BotLevel = connect4.BotLevelEasy
+	game, err = gm.CreateGame("player2", "bot", "channel", options)
+	require.NoError(t, err)
+	_, err = gm.Resign(game.GetID(), "bot")
+	require.NoError(t, err)
+
+	for _, teamID := range []string{"team", "other"} {
+		l, err = gm.GetLeaderboard(teamID, LeaderboardAllTime)
+		require.NoError(t, err)
+		assert.NotContains(t, l, "player2")
+		assert.NotContains(t, l, "bot")
+	}
+}
@@ -35,7 +35,16 @@ const manifestStr = `
   "settings_schema": {
     "header": "",
     "footer": "",
-    "settings": []
+    "settings": [
+      {
+        "key": "InvitationExpiryMinutes",
+        "display_name": "Challenge expiry (minutes):",
+        "type": "number",
+        "help_text": "Minutes a challenged user has to accept the challenge before it expires.",
+        "placeholder": "",
+        "default": 60
+      }
+    ]
   }
 }
 `
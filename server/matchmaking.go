@@ -0,0 +1,98 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/larkox/mattermost-plugin-connect4/server/connect4"
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+// JoinQueue pairs the user with the first user waiting for an opponent in
+// the team, or makes the user wait if nobody is waiting. The game, played
+// with the classic rules in the direct channel of the players, is returned
+// when the user is paired.
+func (gm *GameManager) JoinQueue(teamID, userID string) (connect4.Game, error) {
+	opponentID := ""
+	err := gm.updateQueue(teamID, func(queue []string) ([]string, error) {
+		for _, id := range queue {
+			if id == userID {
+				return nil, errors.New("you are already waiting for an opponent")
+			}
+		}
+
+		if len(queue) == 0 {
+			opponentID = ""
+			return []string{userID}, nil
+		}
+
+		opponentID = queue[0]
+		return queue[1:], nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if opponentID == "" {
+		return nil, nil
+	}
+
+	game, err := gm.CreateGame(opponentID, userID, "", connect4.DefaultOptions())
+	if err != nil {
+		// The user who was waiting keeps their place
+		requeueErr := gm.updateQueue(teamID, func(queue []string) ([]string, error) {
+			for _, id := range queue {
+				if id == opponentID {
+					return queue, nil
+				}
+			}
+			return append([]string{opponentID}, queue...), nil
+		})
+		if requeueErr != nil {
+			gm.api.LogError("could not put the user back in the queue", "user", opponentID, "error", requeueErr.Error())
+		}
+		return nil, err
+	}
+
+	// Let the user who was waiting know the game started
+	opponent, appErr := gm.api.GetUser(opponentID)
+	if appErr == nil {
+		channelID, _, _, _ := game.GetMetadata()
+		_, _ = gm.api.CreatePost(&model.Post{
+			ChannelId: channelID,
+			UserId:    gm.botID,
+			Message:   fmt.Sprintf("@%s, an opponent was found for your random game.", opponent.Username),
+		})
+	}
+	return game, nil
+}
+
+// LeaveQueue stops the user from waiting for an opponent in the team.
+func (gm *GameManager) LeaveQueue(teamID, userID string) error {
+	return gm.updateQueue(teamID, func(queue []string) ([]string, error) {
+		for i, id := range queue {
+			if id == userID {
+				return append(append([]string{}, queue[:i]...), queue[i+1:]...), nil
+			}
+		}
+		return nil, errors.New("you are not waiting for an opponent")
+	})
+}
+
+func queueKey(teamID string) string {
+	return queueKeyPrefix + teamID
+}
+
+// updateQueue stores the result of the update of the users waiting in the
+// team, oldest first.
+func (gm *GameManager) updateQueue(teamID string, update func(queue []string) ([]string, error)) error {
+	return gm.updateRecord(queueKey(teamID), func() interface{} { return &[]string{} }, func(record interface{}) error {
+		queue := record.(*[]string)
+		updated, err := update(*queue)
+		if err != nil {
+			return err
+		}
+		*queue = updated
+		return nil
+	})
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// getTestQueue returns the users waiting in the team.
+func getTestQueue(t *testing.T, gm *GameManager, teamID string) []string {
+	queue := []string{}
+	_, err := gm.getRecord(queueKey(teamID), &queue)
+	require.NoError(t, err)
+	return queue
+}
+
+func TestQueue(t *testing.T) {
+	store := NewMemoryGameStore()
+	gm := newTestGameManager(store)
+
+	game, err := gm.JoinQueue("team", "player1")
+	require.NoError(t, err)
+	assert.Nil(t, game)
+
+	_, err = gm.JoinQueue("team", "player1")
+	assert.EqualError(t, err, "you are already waiting for an opponent")
+
+	// Queues are per team
+	game, err = gm.JoinQueue("other", "player2")
+	require.NoError(t, err)
+	assert.Nil(t, game)
+
+	game, err = gm.JoinQueue("team", "player3")
+	require.NoError(t, err)
+	require.NotNil(t, game)
+	_, _, player1, player2 := game.GetMetadata()
+	assert.Equal(t, "player1", player1)
+	assert.Equal(t, "player3", player2)
+
+	assert.Empty(t, getTestQueue(t, gm, "team"))
+
+	assert.EqualError(t, gm.LeaveQueue("team", "player1"), "you are not waiting for an opponent")
+	require.NoError(t, gm.LeaveQueue("other", "player2"))
+	assert.Empty(t, getTestQueue(t, gm, "other"))
+}
+
+func TestQueueGameNotCreated(t *testing.T) {
+	store := &unsavableStore{NewMemoryGameStore()}
+	gm := newTestGameManager(store)
+
+	_, err := gm.JoinQueue("team", "player1")
+	require.NoError(t, err)
+	_, err = gm.JoinQueue("team", "player2")
+	assert.EqualError(t, err, "storage is full")
+
+	// The user who was waiting is still first in the queue
+	assert.Equal(t, []string{"player1"}, getTestQueue(t, gm, "team"))
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"sync"
+
+	"github.com/larkox/mattermost-plugin-connect4/server/connect4"
+)
+
+// memoryGameStore is a GameStore that keeps the games in memory. Games are
+// stored serialized, so changes to a game are not visible until it is saved.
+type memoryGameStore struct {
+	lock  sync.Mutex
+	games map[string][]byte
+	// ids keeps the games in creation order
+	ids         []string
+	invitations map[string][]byte
+	records     map[string][]byte
+}
+
+func NewMemoryGameStore() GameStore {
+	return &memoryGameStore{
+		games:       map[string][]byte{},
+		invitations: map[string][]byte{},
+		records:     map[string][]byte{},
+	}
+}
+
+func (s *memoryGameStore) Get(id string) (connect4.Game, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	b, ok := s.games[id]
+	if !ok {
+		return nil, nil
+	}
+	return connect4.GameFromJSON(b)
+}
+
+func (s *memoryGameStore) Save(game connect4.Game) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.set(game)
+	return nil
+}
+
+func (s *memoryGameStore) CompareAndSet(old, game connect4.Game) (bool, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	current, ok := s.games[game.GetID()]
+	if ok != (old != nil) || (ok && !bytes.Equal(current, old.ToJSON())) {
+		return false, nil
+	}
+
+	s.set(game)
+	return true, nil
+}
+
+func (s *memoryGameStore) set(game connect4.Game) {
+	if _, ok := s.games[game.GetID()]; !ok {
+		s.ids = append(s.ids, game.GetID())
+	}
+	s.games[game.GetID()] = game.ToJSON()
+}
+
+func (s *memoryGameStore) Delete(id string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	delete(s.games, id)
+	for i, storedID := range s.ids {
+		if storedID == id {
+			s.ids = append(s.ids[:i], s.ids[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (s *memoryGameStore) ListByUser(userID string) ([]connect4.Game, error) {
+	return s.list(func(game connect4.Game) bool {
+		_, _, player1, player2 := game.GetMetadata()
+		return player1 == userID || player2 == userID
+	})
+}
+
+func (s *memoryGameStore) ListByChannel(channelID string) ([]connect4.Game, error) {
+	return s.list(func(game connect4.Game) bool {
+		gameChannelID, _, _, _ := game.GetMetadata()
+		return gameChannelID == channelID
+	})
+}
+
+// list returns the active games matching the filter.
+func (s *memoryGameStore) list(filter func(game connect4.Game) bool) ([]connect4.Game, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	games := []connect4.Game{}
+	for _, id := range s.ids {
+		game, err := connect4.GameFromJSON(s.games[id])
+		if err != nil {
+			return nil, err
+		}
+		if game.Outcome() == connect4.OutcomeNoOutcome && filter(game) {
+			games = append(games, game)
+		}
+	}
+	return games, nil
+}
+
+func (s *memoryGameStore) GetInvitation(id string) (*Invitation, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	b, ok := s.invitations[id]
+	if !ok {
+		return nil, nil
+	}
+	return InvitationFromJSON(b)
+}
+
+func (s *memoryGameStore) CompareAndSetInvitation(old, invitation *Invitation) (bool, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	current, ok := s.invitations[invitation.ID]
+	if ok != (old != nil) || (ok && !bytes.Equal(current, old.ToJSON())) {
+		return false, nil
+	}
+
+	s.invitations[invitation.ID] = invitation.ToJSON()
+	return true, nil
+}
+
+func (s *memoryGameStore) ListPendingInvitations() ([]*Invitation, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	invitations := []*Invitation{}
+	for _, b := range s.invitations {
+		invitation, err := InvitationFromJSON(b)
+		if err != nil {
+			return nil, err
+		}
+		if invitation.Status == InvitationPending {
+			invitations = append(invitations, invitation)
+		}
+	}
+	return invitations, nil
+}
+
+func (s *memoryGameStore) GetRecord(key string) ([]byte, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.records[key], nil
+}
+
+func (s *memoryGameStore) CompareAndSetRecord(key string, old, value []byte) (bool, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	current, ok := s.records[key]
+	if ok != (old != nil) || !bytes.Equal(current, old) {
+		return false, nil
+	}
+
+	s.records[key] = value
+	return true, nil
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"net/http"
 	"sync"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/larkox/mattermost-plugin-badges/badgesmodel"
@@ -24,9 +25,12 @@ type Plugin struct {
 
 	BotUserID string
 
-	gameManager GameManager
+	gameManager *GameManager
 	router      *mux.Router
 	badgesMap   map[string]badgesmodel.BadgeID
+
+	// stopInvitationExpiry stops the job expiring the invitations
+	stopInvitationExpiry chan struct{}
 }
 
 // ServeHTTP demonstrates a plugin that handles HTTP requests by greeting the world.
@@ -46,10 +50,47 @@ func (p *Plugin) OnActivate() error {
 	}
 	p.BotUserID = botID
 
-	p.gameManager = NewGameManager(p.API, botID, p.GrantBadge, p.getAttachmentURL, p.getImageURL)
+	p.gameManager = NewGameManager(p.API, NewKVGameStore(p.API), botID, p.getAttachmentURL, p.getImageURL)
+	p.gameManager.Subscribe(GameFinished, p.grantWinnerBadge)
 
 	p.initializeAPI()
 	p.EnsureBadges()
 
-	return p.API.RegisterCommand(getCommand())
+	err = p.API.RegisterCommand(getCommand())
+	if err != nil {
+		return err
+	}
+
+	// Started last, so a failed activation does not leave it running
+	p.stopInvitationExpiry = make(chan struct{})
+	go p.expireInvitations(p.stopInvitationExpiry)
+
+	return nil
+}
+
+func (p *Plugin) OnDeactivate() error {
+	if p.stopInvitationExpiry != nil {
+		close(p.stopInvitationExpiry)
+		p.stopInvitationExpiry = nil
+	}
+	return nil
+}
+
+// expireInvitations expires the unanswered invitations periodically, until
+// stop is closed.
+func (p *Plugin) expireInvitations(stop chan struct{}) {
+	ticker := time.NewTicker(InvitationExpiryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			err := p.gameManager.ExpireInvitations()
+			if err != nil {
+				p.API.LogError("could not expire the invitations", "error", err.Error())
+			}
+		}
+	}
 }
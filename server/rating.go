@@ -0,0 +1,125 @@
+package main
+
+import (
+	"math"
+	"time"
+
+	"github.com/larkox/mattermost-plugin-connect4/server/connect4"
+)
+
+const (
+	DefaultRating = 1500
+	// ProvisionalGames is the number of ranked games during which the
+	// rating of a new player changes faster, to find its level sooner.
+	ProvisionalGames   = 20
+	ProvisionalKFactor = 40
+	KFactor            = 20
+	// RatingHistoryLength is the number of rating changes kept for each user
+	RatingHistoryLength = 10
+)
+
+// Rating is the Elo rating of a user, based on the ranked games finished.
+type Rating struct {
+	Rating  int
+	Games   int
+	History []RatingChange
+}
+
+// RatingChange is the change of rating after a ranked game.
+type RatingChange struct {
+	GameID     string
+	OpponentID string
+	// Score is 1 for wins, 0.5 for draws and 0 for losses
+	Score     float64
+	Before    int
+	After     int
+	Timestamp time.Time
+}
+
+func newRating() *Rating {
+	return &Rating{Rating: DefaultRating}
+}
+
+func ratingKey(userID string) string {
+	return ratingKeyPrefix + userID
+}
+
+// Provisional tells if the player has not played enough ranked games for
+// the rating to be reliable.
+func (r *Rating) Provisional() bool {
+	return r.Games < ProvisionalGames
+}
+
+func (r *Rating) kFactor() float64 {
+	if r.Provisional() {
+		return ProvisionalKFactor
+	}
+	return KFactor
+}
+
+// add records the result of a game against an opponent with the given rating.
+func (r *Rating) add(gameID, opponentID string, opponentRating int, score float64) {
+	expected := 1 / (1 + math.Pow(10, float64(opponentRating-r.Rating)/400))
+	change := RatingChange{
+		GameID:     gameID,
+		OpponentID: opponentID,
+		Score:      score,
+		Before:     r.Rating,
+		After:      r.Rating + int(math.Round(r.kFactor()*(score-expected))),
+		Timestamp:  time.Now(),
+	}
+
+	r.Rating = change.After
+	r.Games++
+	r.History = append(r.History, change)
+	if len(r.History) > RatingHistoryLength {
+		r.History = r.History[len(r.History)-RatingHistoryLength:]
+	}
+}
+
+// score returns the points the player gets from the finished game.
+func score(outcome, player int) float64 {
+	switch winner(outcome) {
+	case player:
+		return 1
+	case 0:
+		return 0.5
+	}
+	return 0
+}
+
+func (gm *GameManager) GetRating(userID string) (*Rating, error) {
+	rating := newRating()
+	_, err := gm.getRecord(ratingKey(userID), rating)
+	if err != nil {
+		return nil, err
+	}
+	return rating, nil
+}
+
+// updateRatings changes the rating of both players of the finished ranked
+// game, based on their ratings before it.
+func (gm *GameManager) updateRatings(game connect4.Game) error {
+	_, _, player1, player2 := game.GetMetadata()
+	rating1, err := gm.GetRating(player1)
+	if err != nil {
+		return err
+	}
+	rating2, err := gm.GetRating(player2)
+	if err != nil {
+		return err
+	}
+
+	err = gm.addToRating(player1, game.GetID(), player2, rating2.Rating, score(game.Outcome(), connect4.Player1))
+	if err != nil {
+		return err
+	}
+	return gm.addToRating(player2, game.GetID(), player1, rating1.Rating, score(game.Outcome(), connect4.Player2))
+}
+
+func (gm *GameManager) addToRating(userID, gameID, opponentID string, opponentRating int, score float64) error {
+	return gm.updateRecord(ratingKey(userID), func() interface{} { return newRating() }, func(record interface{}) error {
+		record.(*Rating).add(gameID, opponentID, opponentRating, score)
+		return nil
+	})
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/larkox/mattermost-plugin-connect4/server/connect4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRatingAdd(t *testing.T) {
+	r := newRating()
+	r.add("game", "opponent", DefaultRating, 1)
+	assert.Equal(t, DefaultRating+ProvisionalKFactor/2, r.Rating)
+
+	r = &Rating{Rating: 1600, Games: ProvisionalGames}
+	r.add("game", "opponent", 1400, 0.5)
+	// The expected score against a player 200 points weaker is 0.76
+	assert.Equal(t, 1595, r.Rating)
+	assert.False(t, r.Provisional())
+
+	for i := 0; i < RatingHistoryLength+5; i++ {
+		r.add("game", "opponent", 1400, 1)
+	}
+	assert.Len(t, r.History, RatingHistoryLength)
+	assert.Equal(t, RatingHistoryLength+ProvisionalGames+6, r.Games)
+}
+
+func TestRankedGames(t *testing.T) {
+	gm := newTestGameManager(NewMemoryGameStore())
+
+	// Casual games do not change the rating
+	playGame(t, gm, "player1", "player2", 1, 2, 1, 2, 1, 2, 1)
+	rating, err := gm.GetRating("player1")
+	require.NoError(t, err)
+	assert.Equal(t, DefaultRating, rating.Rating)
+	assert.Empty(t, rating.History)
+
+	options := connect4.DefaultOptions()
+	options.FirstPlayer = connect4.Player1
+	options.Ranked = true
+	game, err := gm.CreateGame("player1", "player2", "channel", options)
+	require.NoError(t, err)
+	_, err = gm.Resign(game.GetID(), "player2")
+	require.NoError(t, err)
+
+	rating, err = gm.GetRating("player1")
+	require.NoError(t, err)
+	assert.Equal(t, DefaultRating+20, rating.Rating)
+	require.Len(t, rating.History, 1)
+	assert.Equal(t, RatingChange{
+		GameID:     game.GetID(),
+		OpponentID: "player2",
+		Score:      1,
+		Before:     DefaultRating,
+		After:      DefaultRating + 20,
+		Timestamp:  rating.History[0].Timestamp,
+	}, rating.History[0])
+
+	rating, err = gm.GetRating("player2")
+	require.NoError(t, err)
+	assert.Equal(t, DefaultRating-20, rating.Rating)
+	assert.Equal(t, 1, rating.Games)
+}
@@ -0,0 +1,41 @@
+package main
+
+import "encoding/json"
+
+// getRecord decodes the record stored with the key into record, which is
+// left as it is if there is none. It returns the stored value, to compare
+// it with when the record is updated.
+func (gm *GameManager) getRecord(key string, record interface{}) ([]byte, error) {
+	b, err := gm.store.GetRecord(key)
+	if err != nil || b == nil {
+		return nil, err
+	}
+
+	return b, json.Unmarshal(b, record)
+}
+
+// updateRecord applies the update to the record stored with the key and
+// stores the result, unless the update fails. Each attempt decodes the
+// stored record into a new one from newRecord, which is also the initial
+// value of records not stored yet.
+func (gm *GameManager) updateRecord(key string, newRecord func() interface{}, update func(record interface{}) error) error {
+	return retryUpdate(func() (bool, error) {
+		record := newRecord()
+		old, err := gm.getRecord(key, record)
+		if err != nil {
+			return false, err
+		}
+
+		err = update(record)
+		if err != nil {
+			return false, err
+		}
+
+		value, err := json.Marshal(record)
+		if err != nil {
+			return false, err
+		}
+
+		return gm.store.CompareAndSetRecord(key, old, value)
+	})
+}
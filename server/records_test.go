@@ -0,0 +1,61 @@
+package main
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdateRecord(t *testing.T) {
+	for name, store := range testStores() {
+		t.Run(name, func(t *testing.T) {
+			gm := newTestGameManager(store)
+			newStats := func() interface{} { return &Stats{Draws: 10} }
+
+			// Concurrent updates are applied once each, to the latest record
+			var wg sync.WaitGroup
+			for i := 0; i < 5; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					assert.NoError(t, gm.updateRecord(statsKey("player1"), newStats, func(record interface{}) error {
+						record.(*Stats).Wins++
+						return nil
+					}))
+				}()
+			}
+			wg.Wait()
+
+			stats := &Stats{}
+			old, err := gm.getRecord(statsKey("player1"), stats)
+			require.NoError(t, err)
+			assert.NotNil(t, old)
+			assert.Equal(t, &Stats{Wins: 5, Draws: 10}, stats)
+
+			// Missing records are left as they are
+			stats = &Stats{Losses: 1}
+			old, err = gm.getRecord(statsKey("player2"), stats)
+			require.NoError(t, err)
+			assert.Nil(t, old)
+			assert.Equal(t, &Stats{Losses: 1}, stats)
+		})
+	}
+}
+
+func TestRetryUpdate(t *testing.T) {
+	attempts := 0
+	require.NoError(t, retryUpdate(func() (bool, error) {
+		attempts++
+		return attempts == 3, nil
+	}))
+	assert.Equal(t, 3, attempts)
+
+	attempts = 0
+	assert.Equal(t, errTooManyUpdates, retryUpdate(func() (bool, error) {
+		attempts++
+		return false, nil
+	}))
+	assert.Equal(t, maxUpdateAttempts, attempts)
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/larkox/mattermost-plugin-connect4/server/connect4"
+	"github.com/mattermost/mattermost-server/v5/model"
+)
+
+// RequestTakeback asks the opponent to revert the last movement of the user.
+// The bot always agrees, reverting its own answer too, and the updated game
+// post is returned. Otherwise the opponent is asked and no post is returned.
+func (gm *GameManager) RequestTakeback(id, userID string) (*model.Post, error) {
+	againstBot := false
+	game, err := gm.updateGame(id, func(game connect4.Game) error {
+		player := playerNumber(game, userID)
+		if player == 0 {
+			return errors.New("you are not playing")
+		}
+
+		againstBot = game.GetOptions().BotLevel != connect4.BotLevelNone
+		if againstBot {
+			return takebackAgainstBot(game, player)
+		}
+
+		return game.RequestTakeback(player)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if againstBot {
+		return gm.gameToPost(game), nil
+	}
+
+	gm.events.publish(GameEvent{Type: TakebackRequested, Game: game, UserID: userID})
+	return nil, nil
+}
+
+func (gm *GameManager) AcceptTakeback(id, userID string) (*model.Post, error) {
+	game, err := gm.updateGame(id, func(game connect4.Game) error {
+		player := playerNumber(game, userID)
+		if player == 0 {
+			return errors.New("you are not playing")
+		}
+
+		return game.AcceptTakeback(player)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	gm.events.publish(GameEvent{Type: TakebackAccepted, Game: game, UserID: userID})
+	return gm.gameToPost(game), nil
+}
+
+func (gm *GameManager) DeclineTakeback(id, userID string) error {
+	game, err := gm.updateGame(id, func(game connect4.Game) error {
+		player := playerNumber(game, userID)
+		if player == 0 {
+			return errors.New("you are not playing")
+		}
+
+		return game.DeclineTakeback(player)
+	})
+	if err != nil {
+		return err
+	}
+
+	gm.events.publish(GameEvent{Type: TakebackDeclined, Game: game, UserID: userID})
+	return nil
+}
+
+// OfferDraw sends the opponent of the user an offer to end the game as a draw.
+func (gm *GameManager) OfferDraw(id, userID string) error {
+	game, err := gm.updateGame(id, func(game connect4.Game) error {
+		player := playerNumber(game, userID)
+		if player == 0 {
+			return errors.New("you are not playing")
+		}
+
+		if game.GetOptions().BotLevel != connect4.BotLevelNone {
+			return errors.New("the bot does not accept draws")
+		}
+
+		return game.OfferDraw(player)
+	})
+	if err != nil {
+		return err
+	}
+
+	gm.events.publish(GameEvent{Type: DrawOffered, Game: game, UserID: userID})
+	return nil
+}
+
+func (gm *GameManager) AcceptDraw(id, userID string) (*model.Post, error) {
+	game, err := gm.updateGame(id, func(game connect4.Game) error {
+		player := playerNumber(game, userID)
+		if player == 0 {
+			return errors.New("you are not playing")
+		}
+
+		return game.AcceptDraw(player)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	gm.events.publish(GameEvent{Type: DrawAccepted, Game: game, UserID: userID})
+	return gm.gameToPost(game), nil
+}
+
+func (gm *GameManager) DeclineDraw(id, userID string) error {
+	game, err := gm.updateGame(id, func(game connect4.Game) error {
+		player := playerNumber(game, userID)
+		if player == 0 {
+			return errors.New("you are not playing")
+		}
+
+		return game.DeclineDraw(player)
+	})
+	if err != nil {
+		return err
+	}
+
+	gm.events.publish(GameEvent{Type: DrawDeclined, Game: game, UserID: userID})
+	return nil
+}
+
+// takebackAgainstBot reverts the last movement of the player, and the bot
+// answer to it if there is one.
+func takebackAgainstBot(game connect4.Game, player int) error {
+	if game.Outcome() != connect4.OutcomeNoOutcome {
+		return errors.New("the game has finished")
+	}
+
+	history := game.History()
+	undos := 1
+	if len(history) > 0 && history[len(history)-1].Player != player {
+		undos = 2
+	}
+	if len(history) < undos {
+		return errors.New("you can only take back your last movement")
+	}
+
+	for i := 0; i < undos; i++ {
+		err := game.Undo()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// notifyRequest tells the players about the takeback requests and draw
+// offers, and their answers.
+func (gm *GameManager) notifyRequest(event GameEvent) {
+	switch event.Type {
+	case TakebackRequested:
+		gm.sendRequest(
+			event.Game,
+			event.UserID,
+			"Takeback request",
+			"%s wants to take back their last movement.",
+			AttachmentPathTakebackAccept,
+			AttachmentPathTakebackDecline,
+		)
+	case TakebackAccepted:
+		gm.notifyAnswer(event.Game, event.UserID, "%s accepted your takeback request.")
+	case TakebackDeclined:
+		gm.notifyAnswer(event.Game, event.UserID, "%s declined your takeback request.")
+	case DrawOffered:
+		gm.sendRequest(
+			event.Game,
+			event.UserID,
+			"Draw offer",
+			"%s offers you a draw. The offer expires with the next movement.",
+			AttachmentPathDrawAccept,
+			AttachmentPathDrawDecline,
+		)
+	case DrawAccepted:
+		gm.notifyAnswer(event.Game, event.UserID, "%s accepted your draw offer.")
+	case DrawDeclined:
+		gm.notifyAnswer(event.Game, event.UserID, "%s declined your draw offer.")
+	}
+}
+
+// sendRequest sends the opponent of the requester an ephemeral post to
+// accept or decline the request. The text is formatted with the requester
+// username.
+func (gm *GameManager) sendRequest(game connect4.Game, requesterID, title, text, acceptPath, declinePath string) {
+	channelID, _, player1, player2 := gm.getGameMetadata(game)
+	requester, opponent := player1, player2
+	if requesterID == player2.Id {
+		requester, opponent = player2, player1
+	}
+
+	post := &model.Post{
+		ChannelId: channelID,
+		UserId:    gm.botID,
+	}
+	attachment := &model.SlackAttachment{
+		Title: title,
+		Text:  fmt.Sprintf(text, requester.Username),
+		Actions: []*model.PostAction{
+			{
+				Type: "button",
+				Name: "Accept",
+				Integration: &model.PostActionIntegration{
+					URL: gm.getAttachmentURL() + acceptPath + "/" + game.GetID(),
+				},
+			},
+			{
+				Type: "button",
+				Name: "Decline",
+				Integration: &model.PostActionIntegration{
+					URL: gm.getAttachmentURL() + declinePath + "/" + game.GetID(),
+				},
+			},
+		},
+	}
+	model.ParseSlackAttachment(post, []*model.SlackAttachment{attachment})
+	gm.api.SendEphemeralPost(opponent.Id, post)
+}
+
+// notifyAnswer tells the requester, the opponent of the answerer, the
+// answer. The text is formatted with the answerer username.
+func (gm *GameManager) notifyAnswer(game connect4.Game, answererID, text string) {
+	channelID, _, player1, player2 := gm.getGameMetadata(game)
+	answerer, requester := player1, player2
+	if answererID == player2.Id {
+		answerer, requester = player2, player1
+	}
+
+	gm.api.SendEphemeralPost(requester.Id, &model.Post{
+		ChannelId: channelID,
+		UserId:    gm.botID,
+		Message:   fmt.Sprintf(text, answerer.Username),
+	})
+}
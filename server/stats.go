@@ -0,0 +1,115 @@
+package main
+
+import (
+	"github.com/larkox/mattermost-plugin-connect4/server/connect4"
+)
+
+// Stats are the results of the finished games of a user.
+type Stats struct {
+	Wins   int
+	Losses int
+	Draws  int
+	// Resignations counts the losses by resignation
+	Resignations int
+	// CurrentStreak is the number of games won in a row until the last one
+	CurrentStreak int
+	BestStreak    int
+	// TotalMoves adds up the movements of both players in every game
+	TotalMoves    int
+	GamesAsFirst  int
+	GamesAsSecond int
+}
+
+func statsKey(userID string) string {
+	return statsKeyPrefix + userID
+}
+
+func (s *Stats) Games() int {
+	return s.Wins + s.Losses + s.Draws
+}
+
+// AverageLength returns the average number of movements per game.
+func (s *Stats) AverageLength() float64 {
+	if s.Games() == 0 {
+		return 0
+	}
+	return float64(s.TotalMoves) / float64(s.Games())
+}
+
+// add records the finished game, played as player.
+func (s *Stats) add(game connect4.Game, player int) {
+	switch winner(game.Outcome()) {
+	case player:
+		s.Wins++
+		s.CurrentStreak++
+		if s.CurrentStreak > s.BestStreak {
+			s.BestStreak = s.CurrentStreak
+		}
+	case 0:
+		s.Draws++
+		s.CurrentStreak = 0
+	default:
+		s.Losses++
+		s.CurrentStreak = 0
+		if resigned(game.Outcome()) == player {
+			s.Resignations++
+		}
+	}
+
+	s.TotalMoves += len(game.History())
+	if game.GetOptions().FirstPlayer == player {
+		s.GamesAsFirst++
+	} else {
+		s.GamesAsSecond++
+	}
+}
+
+// winner returns the player who won the game with the outcome, or 0 if nobody did.
+func winner(outcome int) int {
+	switch outcome {
+	case connect4.OutcomePlayer1Win, connect4.OutcomePlayer2Resign:
+		return connect4.Player1
+	case connect4.OutcomePlayer2Win, connect4.OutcomePlayer1Resign:
+		return connect4.Player2
+	}
+	return 0
+}
+
+// resigned returns the player who resigned the game with the outcome, or 0 if nobody did.
+func resigned(outcome int) int {
+	switch outcome {
+	case connect4.OutcomePlayer1Resign:
+		return connect4.Player1
+	case connect4.OutcomePlayer2Resign:
+		return connect4.Player2
+	}
+	return 0
+}
+
+func (gm *GameManager) GetStats(userID string) (*Stats, error) {
+	stats := &Stats{}
+	_, err := gm.getRecord(statsKey(userID), stats)
+	if err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// updateStats adds the finished game to the stats of both players.
+func (gm *GameManager) updateStats(game connect4.Game) error {
+	_, _, player1, player2 := game.GetMetadata()
+	for player, userID := range map[int]string{connect4.Player1: player1, connect4.Player2: player2} {
+		err := gm.addToStats(userID, game, player)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (gm *GameManager) addToStats(userID string, game connect4.Game, player int) error {
+	return gm.updateRecord(statsKey(userID), func() interface{} { return &Stats{} }, func(record interface{}) error {
+		record.(*Stats).add(game, player)
+		return nil
+	})
+}
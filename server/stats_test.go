@@ -0,0 +1,61 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/larkox/mattermost-plugin-connect4/server/connect4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// playGame creates a game where player1 moves first and plays the columns in order.
+func playGame(t *testing.T, gm *GameManager, player1, player2 string, columns ...int) connect4.Game {
+	options := connect4.DefaultOptions()
+	options.FirstPlayer = connect4.Player1
+	game, err := gm.CreateGame(player1, player2, "channel", options)
+	require.NoError(t, err)
+
+	for _, column := range columns {
+		game, err = gm.getGame(game.GetID())
+		require.NoError(t, err)
+		_, err = gm.Move(game.GetID(), game.GetTurnPlayer(), column)
+		require.NoError(t, err)
+	}
+	return game
+}
+
+func TestStats(t *testing.T) {
+	gm := newTestGameManager(NewMemoryGameStore())
+
+	// player1 wins twice in a row, then resigns
+	playGame(t, gm, "player1", "player2", 1, 2, 1, 2, 1, 2, 1)
+	playGame(t, gm, "player1", "player2", 1, 2, 1, 2, 1, 2, 1)
+	game := playGame(t, gm, "player2", "player1", 3)
+	_, err := gm.Resign(game.GetID(), "player1")
+	require.NoError(t, err)
+
+	stats, err := gm.GetStats("player1")
+	require.NoError(t, err)
+	assert.Equal(t, &Stats{
+		Wins:          2,
+		Losses:        1,
+		Resignations:  1,
+		CurrentStreak: 0,
+		BestStreak:    2,
+		TotalMoves:    15,
+		GamesAsFirst:  2,
+		GamesAsSecond: 1,
+	}, stats)
+	assert.Equal(t, 5.0, stats.AverageLength())
+
+	stats, err = gm.GetStats("player2")
+	require.NoError(t, err)
+	assert.Equal(t, 2, stats.Losses)
+	assert.Equal(t, 1, stats.Wins)
+	assert.Equal(t, 1, stats.CurrentStreak)
+	assert.Equal(t, 0, stats.Resignations)
+
+	stats, err = gm.GetStats("player3")
+	require.NoError(t, err)
+	assert.Equal(t, 0, stats.Games())
+}